@@ -0,0 +1,120 @@
+package main
+
+import (
+  "fmt"
+  "sort"
+  "strconv"
+  "strings"
+)
+
+// The outcome of reading an alignment file, kept together with the information needed for validating it
+type parsedAlignment struct {
+  speciesList []speciesGenome
+  lineNumbers []int       // The line on which every sequence begins
+  declaredCount int       // The number of sequences announced by the file, -1 when the format has none
+  declaredLength int      // The number of sites announced by the file, -1 when the format has none
+  declarationLine int
+  diagnostics []alignmentDiagnostic
+}
+
+// A single problem found in the input file
+type alignmentDiagnostic struct {
+  line int
+  message string
+}
+
+func NewParsedAlignment() parsedAlignment {
+  return parsedAlignment{speciesList:make([]speciesGenome, 0), lineNumbers:make([]int, 0),
+                         declaredCount:-1, declaredLength:-1, diagnostics:make([]alignmentDiagnostic, 0)}
+}
+
+func (alignment *parsedAlignment) AddSequence(name, sequence string, line int) {
+  alignment.speciesList = append(alignment.speciesList, speciesGenome{name:name, nucleotideSequence:sequence})
+  alignment.lineNumbers = append(alignment.lineNumbers, line)
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * Checks the alignment for everything that would otherwise only surface in the middle of a run, or worse,
+ * silently alter the results: a wrong sequence count, duplicate names, sequences of different lengths,
+ * unknown characters and sequences made up of gaps only. All the problems are collected and returned
+ * together, sorted by their line in the input file.
+ *------------------------------------------------------------------------------------------------------*/
+func ValidateAlignment(alignment parsedAlignment) []alignmentDiagnostic {
+  diagnostics := append(make([]alignmentDiagnostic, 0), alignment.diagnostics...)
+  speciesList := alignment.speciesList
+
+  if len(speciesList) == 0 {
+    diagnostics = append(diagnostics, alignmentDiagnostic{line:alignment.declarationLine, message:"no sequences were found"})
+    return diagnostics
+  }
+  if alignment.declaredCount >= 0 && alignment.declaredCount != len(speciesList) {
+    diagnostics = append(diagnostics, alignmentDiagnostic{line:alignment.declarationLine,
+                         message:"the file declares " + strconv.Itoa(alignment.declaredCount) + " sequences but holds " +
+                                 strconv.Itoa(len(speciesList))})
+  }
+
+  // Without a declared length, the length shared by most of the sequences is taken as the expected one
+  expectedLength := alignment.declaredLength
+  if expectedLength < 0 {
+    lengthCounts := make(map[int]int)
+    expectedLength = len(speciesList[0].nucleotideSequence)
+    for _, species := range speciesList {
+      lengthCounts[len(species.nucleotideSequence)]++
+      if lengthCounts[len(species.nucleotideSequence)] > lengthCounts[expectedLength] {
+        expectedLength = len(species.nucleotideSequence)
+      }
+    }
+  }
+
+  firstOccurrence := make(map[string]int)
+  for i, species := range speciesList {
+    line := alignment.lineNumbers[i]
+    if firstLine, exists := firstOccurrence[species.name]; exists {
+      diagnostics = append(diagnostics, alignmentDiagnostic{line:line,
+                           message:"duplicate species name " + species.name + " (first defined at line " + strconv.Itoa(firstLine) + ")"})
+    } else {
+      firstOccurrence[species.name] = line
+    }
+
+    sequence := species.nucleotideSequence
+    if len(sequence) != expectedLength {
+      diagnostics = append(diagnostics, alignmentDiagnostic{line:line,
+                           message:"sequence of " + species.name + " has " + strconv.Itoa(len(sequence)) + " sites instead of " +
+                                   strconv.Itoa(expectedLength)})
+    }
+
+    unknownCharacters := make([]string, 0)
+    reportedCharacters := make(map[byte]bool)
+    onlyGaps := true
+    for j:=0; j<len(sequence); j++ {
+      if !IsValidNucleotide(sequence[j]) {
+        if !reportedCharacters[sequence[j]] {
+          reportedCharacters[sequence[j]] = true
+          unknownCharacters = append(unknownCharacters, "'" + string(sequence[j]) + "' at site " + strconv.Itoa(j+1))
+        }
+      } else if !IsGapOrMissing(sequence[j]) {
+        onlyGaps = false
+      }
+    }
+    if len(unknownCharacters) > 0 {
+      diagnostics = append(diagnostics, alignmentDiagnostic{line:line,
+                           message:"sequence of " + species.name + " holds unknown characters: " + strings.Join(unknownCharacters, ", ")})
+    }
+    if onlyGaps {
+      diagnostics = append(diagnostics, alignmentDiagnostic{line:line,
+                           message:"sequence of " + species.name + " consists of gaps only"})
+    }
+  }
+
+  sort.SliceStable(diagnostics, func(i, j int) bool {
+    return diagnostics[i].line < diagnostics[j].line
+  })
+  return diagnostics
+}
+
+func ReportAlignmentDiagnostics(filename string, diagnostics []alignmentDiagnostic) {
+  fmt.Println("The input file " + filename + " holds " + strconv.Itoa(len(diagnostics)) + " problems that need to be fixed:")
+  for _, diagnostic := range diagnostics {
+    fmt.Println("  " + filename + ":" + strconv.Itoa(diagnostic.line) + ": " + diagnostic.message)
+  }
+}
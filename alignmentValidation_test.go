@@ -0,0 +1,44 @@
+package main
+
+import (
+  "strings"
+  "testing"
+)
+
+// Fails the test unless exactly the expected problems were found, in the same order
+func CheckDiagnostics(t *testing.T, diagnostics []alignmentDiagnostic, expected []alignmentDiagnostic) {
+  t.Helper()
+  if len(diagnostics) != len(expected) {
+    t.Fatalf("found %d problems, expected %d: %v", len(diagnostics), len(expected), diagnostics)
+  }
+  for i := range expected {
+    if diagnostics[i] != expected[i] {
+      t.Errorf("problem %d is %v, expected %v", i+1, diagnostics[i], expected[i])
+    }
+  }
+}
+
+func TestValidateAlignment(t *testing.T) {
+  tests := []struct {
+    name string
+    alignment parsedAlignment
+    expected []alignmentDiagnostic
+  }{
+    {"valid alignment", ParseFastaAlignment(strings.Split(">human\nACGT\n>chimp\nAC-T\n", "\n")), nil},
+    {"duplicate names", ParseFastaAlignment(strings.Split(">human\nACGT\n>chimp\nACGA\n\n>human\nACGG\n", "\n")),
+     []alignmentDiagnostic{{6, "duplicate species name human (first defined at line 1)"}}},
+    {"unequal lengths", ParseFastaAlignment(strings.Split(">human\nACGT\n>chimp\nACG\n>gorilla\nACGA\n>orangutan\nACGTAC\n", "\n")),
+     []alignmentDiagnostic{{3, "sequence of chimp has 3 sites instead of 4"}, {7, "sequence of orangutan has 6 sites instead of 4"}}},
+    {"illegal characters", ParseFastaAlignment(strings.Split(">human\nACGT\nAC\n>chimp\nAC\nJT*J\n", "\n")),
+     []alignmentDiagnostic{{4, "sequence of chimp holds unknown characters: 'J' at site 3, '*' at site 5"}}},
+    {"gaps only", ParseFastaAlignment(strings.Split(">human\nACGT\n>chimp\n----\n", "\n")),
+     []alignmentDiagnostic{{3, "sequence of chimp consists of gaps only"}}},
+    {"wrong count", ParseCountPrefixedAlignment(strings.Split("3\nhuman ACGT\nchimp ACGA", "\n")),
+     []alignmentDiagnostic{{1, "the file declares 3 sequences but holds 2"}}},
+  }
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      CheckDiagnostics(t, ValidateAlignment(test.alignment), test.expected)
+    })
+  }
+}
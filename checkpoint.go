@@ -0,0 +1,129 @@
+package main
+
+import (
+  "encoding/json"
+  "fmt"
+  "math/rand/v2"
+  "os"
+  "strconv"
+)
+
+/*-------------------------------------------------------------------------------------------------------
+ * The complete state of a GA run in between two generations. Along with the settings of the config file,
+ * it is all that is needed for continuing a run exactly where it stopped.
+ *------------------------------------------------------------------------------------------------------*/
+type gaState struct {
+  population []*node
+  generation int
+  maxLikelihoodScores []float64
+  rngSource *rand.PCG
+
+  // The signal that stopped the run early, if any
+  interruptedBy os.Signal
+}
+
+// The layout of a checkpoint file on disk
+type checkpointFile struct {
+  Generation int                `json:"generation"`
+  MaxLikelihoodScores []float64 `json:"maxLikelihoodScores"`
+  RandomState []byte            `json:"randomState"`
+  Population []checkpointTree   `json:"population"`
+}
+
+type checkpointTree struct {
+  Newick string           `json:"newick"`
+  Model checkpointModel   `json:"model"`
+}
+
+type checkpointModel struct {
+  Name string                    `json:"name"`
+  NumStates int                  `json:"numStates"`
+  Exchangeabilities [6]float64   `json:"exchangeabilities"`
+  GapExchangeability float64     `json:"gapExchangeability"`
+  Frequencies [5]float64         `json:"frequencies"`
+  GammaCategories int            `json:"gammaCategories"`
+  GammaAlpha float64             `json:"gammaAlpha"`
+  InvariantProportion float64    `json:"invariantProportion"`
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * Writes the state of the run to the given file. The trees are stored as Newick strings with their branch
+ * lengths at full precision, and the file is first written under a temporary name and then moved into
+ * place, so that a crash while writing never destroys the previous checkpoint.
+ *------------------------------------------------------------------------------------------------------*/
+func WriteCheckpoint(state *gaState, filename string) {
+  randomState, err := state.rngSource.MarshalBinary()
+  if err != nil {
+    fmt.Println("Something went wrong while trying to save the random number generator state: " + err.Error())
+    os.Exit(1)
+  }
+  checkpoint := checkpointFile{Generation:state.generation, MaxLikelihoodScores:state.maxLikelihoodScores[:state.generation],
+                               RandomState:randomState, Population:make([]checkpointTree, len(state.population))}
+  for i, solution := range state.population {
+    model := solution.model
+    checkpoint.Population[i] = checkpointTree{Newick:NewickFormatWithPrecision(solution, -1),
+                                              Model:checkpointModel{Name:model.name, NumStates:model.numStates,
+                                                                    Exchangeabilities:model.exchangeabilities,
+                                                                    GapExchangeability:model.gapExchangeability,
+                                                                    Frequencies:model.frequencies,
+                                                                    GammaCategories:model.gammaCategories,
+                                                                    GammaAlpha:model.gammaAlpha,
+                                                                    InvariantProportion:model.invariantProportion}}
+  }
+
+  data, err := json.MarshalIndent(checkpoint, "", "  ")
+  if err == nil {
+    err = os.WriteFile(filename + ".tmp", data, 0644)
+  }
+  if err == nil {
+    err = os.Rename(filename + ".tmp", filename)
+  }
+  if err != nil {
+    fmt.Println("Something went wrong while trying to write the checkpoint file:" + filename)
+    os.Exit(1)
+  }
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * Restores the state of a run from a checkpoint file. The history of the likelihood scores is extended to
+ * hold the given number of generations.
+ *------------------------------------------------------------------------------------------------------*/
+func LoadCheckpoint(filename string, numGenerations int) *gaState {
+  data, err := os.ReadFile(filename)
+  if err != nil {
+    fmt.Println("Something went wrong while trying to read the checkpoint file:" + filename)
+    os.Exit(1)
+  }
+  var checkpoint checkpointFile
+  if err := json.Unmarshal(data, &checkpoint); err != nil {
+    fmt.Println("Invalid checkpoint file " + filename + ": " + err.Error())
+    os.Exit(1)
+  }
+  if len(checkpoint.Population) == 0 || len(checkpoint.MaxLikelihoodScores) != checkpoint.Generation {
+    fmt.Println("Invalid checkpoint file " + filename + "; the population or score history is incomplete")
+    os.Exit(1)
+  }
+
+  state := &gaState{generation:checkpoint.Generation, rngSource:&rand.PCG{},
+                    maxLikelihoodScores:make([]float64, max(numGenerations, checkpoint.Generation)),
+                    population:make([]*node, len(checkpoint.Population))}
+  copy(state.maxLikelihoodScores, checkpoint.MaxLikelihoodScores)
+  if err := state.rngSource.UnmarshalBinary(checkpoint.RandomState); err != nil {
+    fmt.Println("Invalid checkpoint file " + filename + "; the random number generator state is damaged")
+    os.Exit(1)
+  }
+  for i, tree := range checkpoint.Population {
+    state.population[i] = ParseNewickTree(tree.Newick, nil)
+    model := NewSubstitutionModel(tree.Model.Name, tree.Model.NumStates == 5)
+    model.exchangeabilities = tree.Model.Exchangeabilities
+    model.gapExchangeability = tree.Model.GapExchangeability
+    model.frequencies = tree.Model.Frequencies
+    model.gammaCategories = tree.Model.GammaCategories
+    model.gammaAlpha = tree.Model.GammaAlpha
+    model.invariantProportion = tree.Model.InvariantProportion
+    model.decomposed, model.categoryRates, model.categoryWeights = false, nil, nil
+    state.population[i].model = model
+  }
+  fmt.Println("Resuming the run of checkpoint " + filename + " at generation " + strconv.Itoa(state.generation))
+  return state
+}
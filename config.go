@@ -0,0 +1,535 @@
+package main
+
+import (
+  "bufio"
+  "encoding/json"
+  "fmt"
+  "math"
+  "os"
+  "sort"
+  "strconv"
+  "strings"
+)
+
+/*-------------------------------------------------------------------------------------------------------
+ * The complete set of parameters of a run. It starts out with the defaults below, is then filled in from
+ * the config file and the command line, and is validated as a whole before the run begins.
+ *------------------------------------------------------------------------------------------------------*/
+type gaConfig struct {
+  populationCount int
+  generationsCount int
+  stableGenerationsLimit int
+  sequenceLengthMax int
+  proliferationFraction float64
+
+  branchLengthMutationRate float64
+  topologyMutationRate float64
+  crossoverRate float64
+  nucleotideMutationRate float64
+
+  gapsAsMissing bool
+  modelName string
+  gammaCategories int
+  gammaAlpha float64
+  invariantProportion float64
+
+  // The criterion the trees are scored by, the costs of the changes under weighted (Sankoff) parsimony and
+  // the correction of the distances used by the distance criteria
+  fitnessCriterion string
+  parsimonyMethod string
+  transitionCost, transversionCost, gapCost float64
+  distanceCorrection string
+
+  threadsCount int
+  siteThreads int
+  randomSeed int
+  checkpointInterval int
+  checkpointFile string
+
+  // The make-up of the initial population; whatever is not seeded is filled with random trees
+  seedTreesFile string
+  userSeedProportion float64
+  njSeedProportion float64
+  njSeedMethod string
+  upgmaSeedProportion float64
+  seedPerturbation float64
+
+  samplingInterval int
+  drawWidth, drawHeight int
+  summaryFile string
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * Named sets of properties for common kinds of runs, picked with the -preset flag. A JSON config file can
+ * define presets of its own, which take precedence over these.
+ *------------------------------------------------------------------------------------------------------*/
+var builtinConfigPresets = map[string]map[string]any{
+  // A short run for trying out a dataset or a change of the settings
+  "quick": {
+    "ga.algo.params.population.count": 20,
+    "ga.algo.params.generations.count": 500,
+    "ga.algo.params.generations.stable.limit": 100,
+    "ga.algo.params.model.gamma.categories": 0,
+    "ga.algo.params.model.invariant.proportion": 0.0,
+    "ga.checkpoint.interval": 0,
+    "ga.output.sampling.interval": 50,
+  },
+  // A long run with a large population and the most general substitution model
+  "thorough": {
+    "ga.algo.params.population.count": 200,
+    "ga.algo.params.generations.count": 100000,
+    "ga.algo.params.generations.stable.limit": 5000,
+    "ga.algo.params.model": "GTR",
+    "ga.algo.params.model.gamma.categories": 8,
+    "ga.checkpoint.interval": 500,
+    "ga.output.sampling.interval": 1000,
+  },
+  // Many taxa or long alignments, where a single likelihood evaluation is expensive
+  "large-dataset": {
+    "ga.algo.params.population.count": 100,
+    "ga.algo.params.generations.count": 50000,
+    "ga.algo.params.generations.stable.limit": 2000,
+    "ga.algo.params.threads.count": 0,
+    "ga.algo.params.threads.sites": 4,
+    "ga.checkpoint.interval": 50,
+    "ga.output.sampling.interval": 500,
+  },
+}
+
+// The keys of the map in sorted order, so that settings are always applied and reported in the same order
+func SortedKeys(settings map[string]any) []string {
+  keys := make([]string, 0, len(settings))
+  for key := range settings {
+    keys = append(keys, key)
+  }
+  sort.Strings(keys)
+  return keys
+}
+
+// A property of the config file, bound to the field of the configuration that holds its value
+type configProperty struct {
+  name string
+  value any             // One of *int, *float64, *bool or *string
+  min, max float64      // The allowed range of a numeric value
+  choices []string      // The allowed values of a string; any value when empty
+}
+
+func DefaultConfig() *gaConfig {
+  return &gaConfig{populationCount:50, generationsCount:20000, stableGenerationsLimit:500, sequenceLengthMax:0,
+                   proliferationFraction:0.2, branchLengthMutationRate:0.05, topologyMutationRate:0.25,
+                   crossoverRate:0.25, nucleotideMutationRate:0.1, gapsAsMissing:false, modelName:"HKY85",
+                   gammaCategories:4, gammaAlpha:0.5, invariantProportion:0.1, fitnessCriterion:"likelihood",
+                   parsimonyMethod:"fitch", transitionCost:1, transversionCost:2, gapCost:2, distanceCorrection:"JC69", threadsCount:0, siteThreads:1,
+                   randomSeed:0, checkpointInterval:100, checkpointFile:"checkpoint.json",
+                   seedTreesFile:"", userSeedProportion:0, njSeedProportion:0.2, njSeedMethod:"NJ", upgmaSeedProportion:0.1, seedPerturbation:0.3,
+                   samplingInterval:100, drawWidth:195, drawHeight:45, summaryFile:"ga_summary.txt"}
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * Every property that can be set, along with its allowed values. Ranges are inclusive, and the names are
+ * the ones used by the config file and the -set flag.
+ *------------------------------------------------------------------------------------------------------*/
+func (config *gaConfig) Properties() []configProperty {
+  return []configProperty{
+    {name:"ga.algo.params.population.count", value:&config.populationCount, min:2, max:math.MaxInt32},
+    {name:"ga.algo.params.generations.count", value:&config.generationsCount, min:1, max:math.MaxInt32},
+    {name:"ga.algo.params.generations.stable.limit", value:&config.stableGenerationsLimit, min:1, max:math.MaxInt32},
+    {name:"ga.algo.params.sequencedata.length.max", value:&config.sequenceLengthMax, min:0, max:math.MaxInt32},
+    {name:"ga.algo.params.selection.proliferation.fraction", value:&config.proliferationFraction, min:0, max:1},
+    {name:"ga.algo.params.mutation.branchlength", value:&config.branchLengthMutationRate, min:0, max:1},
+    {name:"ga.algo.params.mutation.topology", value:&config.topologyMutationRate, min:0, max:1},
+    {name:"ga.algo.params.crossover", value:&config.crossoverRate, min:0, max:1},
+    {name:"ga.algo.params.mutation.nucleotide", value:&config.nucleotideMutationRate, min:0, max:1},
+    {name:"ga.algo.params.gaps.missing", value:&config.gapsAsMissing},
+    {name:"ga.algo.params.model", value:&config.modelName, choices:[]string{"JC69", "K80", "F81", "HKY85", "TN93", "GTR"}},
+    {name:"ga.algo.params.model.gamma.categories", value:&config.gammaCategories, min:0, max:64},
+    {name:"ga.algo.params.model.gamma.alpha", value:&config.gammaAlpha, min:0.01, max:100},
+    {name:"ga.algo.params.model.invariant.proportion", value:&config.invariantProportion, min:0, max:0.99},
+    {name:"ga.algo.params.fitness", value:&config.fitnessCriterion, choices:TreeScorerNames()},
+    {name:"ga.algo.params.parsimony.method", value:&config.parsimonyMethod, choices:[]string{"fitch", "sankoff"}},
+    {name:"ga.algo.params.parsimony.cost.transition", value:&config.transitionCost, min:0, max:1000},
+    {name:"ga.algo.params.parsimony.cost.transversion", value:&config.transversionCost, min:0, max:1000},
+    {name:"ga.algo.params.parsimony.cost.gap", value:&config.gapCost, min:0, max:1000},
+    {name:"ga.algo.params.distance.correction", value:&config.distanceCorrection, choices:distanceCorrections},
+    {name:"ga.algo.params.threads.count", value:&config.threadsCount, min:0, max:4096},
+    {name:"ga.algo.params.threads.sites", value:&config.siteThreads, min:1, max:4096},
+    {name:"ga.random.seed", value:&config.randomSeed, min:0, max:math.MaxInt64},
+    {name:"ga.checkpoint.interval", value:&config.checkpointInterval, min:0, max:math.MaxInt32},
+    {name:"ga.checkpoint.file", value:&config.checkpointFile},
+    {name:"ga.init.trees.file", value:&config.seedTreesFile},
+    {name:"ga.init.proportion.user", value:&config.userSeedProportion, min:0, max:1},
+    {name:"ga.init.proportion.nj", value:&config.njSeedProportion, min:0, max:1},
+    {name:"ga.init.nj.method", value:&config.njSeedMethod, choices:[]string{"NJ", "BIONJ"}},
+    {name:"ga.init.proportion.upgma", value:&config.upgmaSeedProportion, min:0, max:1},
+    {name:"ga.init.perturbation", value:&config.seedPerturbation, min:0, max:1},
+    {name:"ga.output.sampling.interval", value:&config.samplingInterval, min:1, max:math.MaxInt32},
+    {name:"ga.output.draw.width", value:&config.drawWidth, min:1, max:10000},
+    {name:"ga.output.draw.height", value:&config.drawHeight, min:1, max:10000},
+    {name:"ga.output.summary.file", value:&config.summaryFile},
+  }
+}
+
+// Looks up a property by its name
+func (config *gaConfig) Property(name string) (configProperty, bool) {
+  for _, property := range config.Properties() {
+    if property.name == name {
+      return property, true
+    }
+  }
+  return configProperty{}, false
+}
+
+// The type of the property as written in the config file
+func (property configProperty) TypeName() string {
+  switch property.value.(type) {
+  case *int:
+    return "int"
+  case *float64:
+    return "float64"
+  case *bool:
+    return "bool"
+  }
+  return "string"
+}
+
+func (property configProperty) String() string {
+  switch val := property.value.(type) {
+  case *int:
+    return strconv.Itoa(*val)
+  case *float64:
+    return strconv.FormatFloat(*val, 'g', -1, 64)
+  case *bool:
+    return strconv.FormatBool(*val)
+  case *string:
+    return *val
+  }
+  return ""
+}
+
+// Parses the given text as the value of the property, leaving the property untouched if it is invalid
+func (property configProperty) Set(text string) error {
+  switch val := property.value.(type) {
+  case *int:
+    intVal, err := strconv.Atoi(text)
+    if err != nil {
+      return fmt.Errorf("%s is not a valid int value for %s", text, property.name)
+    }
+    *val = intVal
+  case *float64:
+    floatVal, err := strconv.ParseFloat(text, 64)
+    if err != nil {
+      return fmt.Errorf("%s is not a valid float64 value for %s", text, property.name)
+    }
+    *val = floatVal
+  case *bool:
+    boolVal, err := strconv.ParseBool(text)
+    if err != nil {
+      return fmt.Errorf("%s is not a valid bool value for %s", text, property.name)
+    }
+    *val = boolVal
+  case *string:
+    *val = text
+  }
+  return nil
+}
+
+// Sets the property from a value of a matching Go type, ie. one decoded from a JSON file or given by a preset
+func (property configProperty) SetValue(value any) error {
+  typeName := property.TypeName()
+  switch val := value.(type) {
+  case json.Number:
+    if typeName == "int" || typeName == "float64" {
+      return property.Set(val.String())
+    }
+  case int:
+    if typeName == "int" || typeName == "float64" {
+      return property.Set(strconv.Itoa(val))
+    }
+  case float64:
+    if typeName == "float64" {
+      return property.Set(strconv.FormatFloat(val, 'g', -1, 64))
+    }
+  case bool:
+    if typeName == "bool" {
+      return property.Set(strconv.FormatBool(val))
+    }
+  case string:
+    if typeName == "string" {
+      return property.Set(val)
+    }
+  }
+  return fmt.Errorf("%s expects a value of type %s", property.name, typeName)
+}
+
+// Checks the current value of the property against its allowed range or choices. Choices are matched regardless of
+// their case, and the value is replaced by the spelling of the choice so that the rest of the program can compare exactly.
+func (property configProperty) Validate() error {
+  var numericValue float64
+  switch val := property.value.(type) {
+  case *int:
+    numericValue = float64(*val)
+  case *float64:
+    numericValue = *val
+  case *string:
+    if len(property.choices) == 0 {
+      return nil
+    }
+    for _, choice := range property.choices {
+      if strings.EqualFold(choice, *val) {
+        *val = choice
+        return nil
+      }
+    }
+    return fmt.Errorf("%s has to be one of %s, not %s", property.name, strings.Join(property.choices, ", "), *val)
+  default:
+    return nil
+  }
+  if math.IsNaN(numericValue) || numericValue < property.min || numericValue > property.max {
+    return fmt.Errorf("%s has to lie within [%s, %s], not %s", property.name, strconv.FormatFloat(property.min, 'f', -1, 64),
+                      strconv.FormatFloat(property.max, 'f', -1, 64), property.String())
+  }
+  return nil
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * Since there have been a lot of variable parameter for the algorithm, I have decided that moving forward
+ * with a config style approach would be more convenient rather than using the traditional command line
+ * approach. The file is either a JSON file or the original config.txt format, and properties that are left
+ * out of it keep their default values. A preset, if one is named, is applied on top of the file; it is
+ * looked up among the presets of the file first and the built-in ones after.
+ *------------------------------------------------------------------------------------------------------*/
+func LoadConfigFile(filename, presetName string) *gaConfig {
+  config := DefaultConfig()
+  presets := make(map[string]map[string]any)
+  for name, preset := range builtinConfigPresets {
+    presets[name] = preset
+  }
+  if IsJSONConfig(filename) {
+    for name, preset := range LoadJSONConfig(filename, config) {
+      presets[name] = preset
+    }
+  } else {
+    LoadTextConfig(filename, config)
+  }
+
+  if presetName != "" {
+    preset, exists := presets[presetName]
+    if !exists {
+      names := make([]string, 0, len(presets))
+      for name := range presets {
+        names = append(names, name)
+      }
+      sort.Strings(names)
+      fmt.Println("Unknown config preset " + presetName + "; available presets are " + strings.Join(names, ", "))
+      os.Exit(1)
+    }
+    problems := make([]string, 0)
+    for _, name := range SortedKeys(preset) {
+      if err := ApplyConfigValue(config, name, preset[name]); err != nil {
+        problems = append(problems, err.Error())
+      }
+    }
+    if len(problems) > 0 {
+      ReportConfigProblems("The preset " + presetName, problems)
+      os.Exit(1)
+    }
+    fmt.Println("Applied the config preset " + presetName)
+  }
+  fmt.Println("Succesfully loaded data from config file into program")
+  return config
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * The original config.txt format, where every line has the form property=value,type. Unknown properties,
+ * mismatched types and unparsable values are all collected and reported together, before any of the GA
+ * work can start.
+ *------------------------------------------------------------------------------------------------------*/
+func LoadTextConfig(filename string, config *gaConfig) {
+  file, err := os.Open(filename)
+  if err != nil {
+    fmt.Println("Something went wrong while trying to read the input file:" + filename)
+    os.Exit(1)
+  }
+  problems := make([]configProblem, 0)
+
+  scanner := bufio.NewScanner(file)
+  for lineNumber := 1; scanner.Scan(); lineNumber++ {
+    line := strings.TrimSpace(scanner.Text())
+    if line == "" || strings.HasPrefix(line, "#") {
+      continue
+    }
+    name, typedValue, found := strings.Cut(line, "=")
+    commaIndex := strings.LastIndex(typedValue, ",")
+    if !found || commaIndex < 0 {
+      problems = append(problems, configProblem{line:lineNumber, message:"expected property=value,type but found " + line})
+      continue
+    }
+    value, typeName := typedValue[:commaIndex], typedValue[commaIndex+1:]
+
+    property, exists := config.Property(name)
+    if !exists {
+      problems = append(problems, configProblem{line:lineNumber, message:UnknownPropertyMessage(config, name)})
+      continue
+    }
+    if typeName != property.TypeName() {
+      problems = append(problems, configProblem{line:lineNumber,
+                       message:name + " is of type " + property.TypeName() + ", not " + typeName})
+      continue
+    }
+    if err := property.Set(value); err != nil {
+      problems = append(problems, configProblem{line:lineNumber, message:err.Error()})
+    }
+  }
+  file.Close()
+  if scanner.Err() != nil {
+    fmt.Println("Something went wrong while trying to read the input file:" + filename)
+    os.Exit(1)
+  }
+  if len(problems) > 0 {
+    ReportConfigFileProblems(filename, problems)
+    os.Exit(1)
+  }
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * Builds the configuration of a run from the config file, the preset and the -set overrides of the
+ * command line, in this order of precedence. The result is validated and printed.
+ *------------------------------------------------------------------------------------------------------*/
+func LoadValidatedConfig(filename, presetName string, overrides []string) *gaConfig {
+  config := LoadConfigFile(filename, presetName)
+  for _, setting := range overrides {
+    config.Override(setting)
+  }
+  if problems := config.Validate(); len(problems) > 0 {
+    ReportConfigProblems("The configuration", problems)
+    os.Exit(1)
+  }
+  config.Print()
+  return config
+}
+
+// Looks up the property of the given name and sets it to the value
+func ApplyConfigValue(config *gaConfig, name string, value any) error {
+  property, exists := config.Property(name)
+  if !exists {
+    return fmt.Errorf("%s", UnknownPropertyMessage(config, name))
+  }
+  return property.SetValue(value)
+}
+
+func ReportConfigProblems(source string, problems []string) {
+  fmt.Println(source + " holds " + strconv.Itoa(len(problems)) + " problems that need to be fixed:")
+  for _, problem := range problems {
+    fmt.Println("  " + problem)
+  }
+}
+
+// A single problem found in a line of the config file
+type configProblem struct {
+  line int
+  message string
+}
+
+func ReportConfigFileProblems(filename string, problems []configProblem) {
+  fmt.Println("The config file " + filename + " holds " + strconv.Itoa(len(problems)) + " problems that need to be fixed:")
+  for _, problem := range problems {
+    fmt.Println("  " + filename + ":" + strconv.Itoa(problem.line) + ": " + problem.message)
+  }
+}
+
+// The property=value settings given on the command line, in the order they appeared
+type configOverrides []string
+
+func (overrides *configOverrides) String() string {
+  return strings.Join(*overrides, " ")
+}
+
+func (overrides *configOverrides) Set(setting string) error {
+  *overrides = append(*overrides, setting)
+  return nil
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * Replaces the value of a property by the one given in a setting of the form property=value, ie. from the
+ * -set flag of the command line. The value is read as the type of the property.
+ *------------------------------------------------------------------------------------------------------*/
+func (config *gaConfig) Override(setting string) {
+  name, value, found := strings.Cut(setting, "=")
+  if !found {
+    fmt.Println("Invalid config override " + setting + "; expected property=value")
+    os.Exit(1)
+  }
+  property, exists := config.Property(strings.TrimSpace(name))
+  if !exists {
+    fmt.Println("Invalid config override " + setting + "; " + UnknownPropertyMessage(config, strings.TrimSpace(name)))
+    os.Exit(1)
+  }
+  if err := property.Set(strings.TrimSpace(value)); err != nil {
+    fmt.Println("Invalid config override " + setting + "; " + err.Error())
+    os.Exit(1)
+  }
+}
+
+// Checks every property of the configuration, returning all the problems found
+func (config *gaConfig) Validate() []string {
+  problems := make([]string, 0)
+  for _, property := range config.Properties() {
+    if err := property.Validate(); err != nil {
+      problems = append(problems, err.Error())
+    }
+  }
+  if config.checkpointInterval > 0 && config.checkpointFile == "" {
+    problems = append(problems, "ga.checkpoint.file has to be set when ga.checkpoint.interval is enabled")
+  }
+  if config.userSeedProportion + config.njSeedProportion + config.upgmaSeedProportion > 1 {
+    problems = append(problems, "ga.init.proportion.user, ga.init.proportion.nj and ga.init.proportion.upgma add up to more than 1")
+  }
+  if config.userSeedProportion > 0 && config.seedTreesFile == "" {
+    problems = append(problems, "ga.init.trees.file has to be set when ga.init.proportion.user is above 0")
+  }
+  return problems
+}
+
+// Prints every property in effect for the run, in the format of the config file
+func (config *gaConfig) Print() {
+  fmt.Println("Effective configuration:")
+  for _, property := range config.Properties() {
+    fmt.Println("  " + property.name + "=" + property.String() + "," + property.TypeName())
+  }
+}
+
+// The error message for a property that does not exist, pointing out the closest known one in case of a typo
+func UnknownPropertyMessage(config *gaConfig, name string) string {
+  message := "unknown property " + name
+  closestDistance, closestName := 4, ""
+  for _, property := range config.Properties() {
+    if distance := EditDistance(name, property.name); distance < closestDistance {
+      closestDistance, closestName = distance, property.name
+    }
+  }
+  if closestName != "" {
+    message += " (did you mean " + closestName + "?)"
+  }
+  return message
+}
+
+// The number of single character insertions, deletions and substitutions turning one string into the other
+func EditDistance(a, b string) int {
+  previousRow := make([]int, len(b)+1)
+  currentRow := make([]int, len(b)+1)
+  for j:=0; j<=len(b); j++ {
+    previousRow[j] = j
+  }
+  for i:=1; i<=len(a); i++ {
+    currentRow[0] = i
+    for j:=1; j<=len(b); j++ {
+      substitutionCost := 1
+      if a[i-1] == b[j-1] {
+        substitutionCost = 0
+      }
+      currentRow[j] = min(previousRow[j]+1, currentRow[j-1]+1, previousRow[j-1]+substitutionCost)
+    }
+    previousRow, currentRow = currentRow, previousRow
+  }
+  return previousRow[len(b)]
+}
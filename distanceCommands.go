@@ -0,0 +1,155 @@
+package main
+
+import (
+  "flag"
+  "fmt"
+  "os"
+  "slices"
+  "strconv"
+  "strings"
+)
+
+/*-------------------------------------------------------------------------------------------------------
+ * The distances command: writes the distances between all pairs of taxa of an alignment, for use by other
+ * tools. The correction and the handling of gaps are chosen as for the tree commands.
+ *   ./GA_Phylogeny distances [-correction p|JC69|K2P|TN93|LogDet] [-gaps pairwise|complete]
+ *                            [-format phylip|csv] [-output file] alignment
+ *------------------------------------------------------------------------------------------------------*/
+func RunDistancesCommand(arguments []string) {
+  flags := flag.NewFlagSet("distances", flag.ExitOnError)
+  correctionFlag, gapsFlag := DistanceFlags(flags)
+  formatFlag := flags.String("format", "phylip", "the format of the matrix; phylip or csv")
+  outputFlag := flags.String("output", "", "the file the matrix is written to; printed when not given")
+  flags.Parse(arguments)
+  if flags.NArg() != 1 {
+    fmt.Println("Usage: ./GA_Phylogeny distances [flags] alignment")
+    flags.PrintDefaults()
+    os.Exit(1)
+  }
+  format := strings.ToLower(*formatFlag)
+  if format != "phylip" && format != "csv" {
+    fmt.Println("-format has to be one of phylip, csv, not " + *formatFlag)
+    os.Exit(1)
+  }
+  correction, completeDeletion := ParseDistanceFlags(*correctionFlag, *gapsFlag)
+
+  speciesList, _ := LoadDatasets(flags.Arg(0))
+  matrix := ComputeCorrectedDistances(speciesList, correction, completeDeletion)
+  writer := os.Stdout
+  if *outputFlag != "" {
+    file, err := os.Create(*outputFlag)
+    if err != nil {
+      fmt.Println("Something went wrong while trying to write the distance file:" + *outputFlag)
+      os.Exit(1)
+    }
+    defer file.Close()
+    writer = file
+  }
+  var err error
+  if format == "csv" {
+    err = WriteCSVDistances(writer, matrix)
+  } else {
+    err = WritePhylipDistances(writer, matrix)
+  }
+  if err != nil {
+    fmt.Println("Something went wrong while trying to write the distances: " + err.Error())
+    os.Exit(1)
+  }
+}
+
+// The flags choosing the correction of the distances and the handling of gaps
+func DistanceFlags(flags *flag.FlagSet) (*string, *string) {
+  correctionFlag := flags.String("correction", "JC69", "the correction of the distances; one of " + strings.Join(distanceCorrections, ", "))
+  gapsFlag := flags.String("gaps", "pairwise", "sites with gaps or ambiguous characters are left out per pair (pairwise) or for all pairs (complete)")
+  return correctionFlag, gapsFlag
+}
+
+// Checks the values of the distance flags, returning the correction and whether complete deletion is asked for
+func ParseDistanceFlags(correctionFlag, gapsFlag string) (string, bool) {
+  correction := CanonicalCorrection(correctionFlag)
+  if correction == "" {
+    fmt.Println("-correction has to be one of " + strings.Join(distanceCorrections, ", ") + ", not " + correctionFlag)
+    os.Exit(1)
+  }
+  gaps := strings.ToLower(gapsFlag)
+  if gaps != "pairwise" && gaps != "complete" {
+    fmt.Println("-gaps has to be one of pairwise, complete, not " + gapsFlag)
+    os.Exit(1)
+  }
+  return correction, gaps == "complete"
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * The nj command: builds the Neighbor-Joining or BIONJ tree of the distances of an alignment, as a fast
+ * baseline for the trees of the GA.
+ *   ./GA_Phylogeny nj [-method NJ|BIONJ] [-correction name] [-gaps pairwise|complete] [-output treefile] [-score] alignment
+ *------------------------------------------------------------------------------------------------------*/
+func RunNJCommand(arguments []string) {
+  RunDistanceTreeCommand("nj", []string{"NJ", "BIONJ"}, arguments)
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * The upgma command: builds the rooted UPGMA or WPGMA tree of the distances, which suits datasets evolving
+ * under a molecular clock.
+ *   ./GA_Phylogeny upgma [-method UPGMA|WPGMA] [-correction name] [-gaps pairwise|complete] [-output treefile] [-score] alignment
+ *------------------------------------------------------------------------------------------------------*/
+func RunUPGMACommand(arguments []string) {
+  RunDistanceTreeCommand("upgma", []string{"UPGMA", "WPGMA"}, arguments)
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * Shared by the distance tree commands. The tree is printed in the Newick format and, with -output,
+ * written to a file that can be handed to the score command or to ga.init.trees.file. With -score its log
+ * likelihood is computed as well, under the substitution model of the config, so that it can be compared
+ * with the trees of the GA.
+ *------------------------------------------------------------------------------------------------------*/
+func RunDistanceTreeCommand(command string, methods []string, arguments []string) {
+  flags := flag.NewFlagSet(command, flag.ExitOnError)
+  methodFlag := flags.String("method", methods[0], "the tree building method; one of " + strings.Join(methods, ", "))
+  correctionFlag, gapsFlag := DistanceFlags(flags)
+  outputFlag := flags.String("output", "", "the file the tree is written to, besides printing it")
+  scoreFlag := flags.Bool("score", false, "compute the log likelihood of the tree under the model of the config")
+  configFlag := flags.String("config", "config.txt", "the config file holding the model settings for -score; either JSON or the config.txt format")
+  presetFlag := flags.String("preset", "", "a named set of parameters applied over the config file")
+  var overrides configOverrides
+  flags.Var(&overrides, "set", "property=value overriding a property of the config file; can be repeated")
+  flags.Parse(arguments)
+  if flags.NArg() != 1 {
+    fmt.Println("Usage: ./GA_Phylogeny " + command + " [flags] alignment")
+    flags.PrintDefaults()
+    os.Exit(1)
+  }
+  method := strings.ToUpper(*methodFlag)
+  if !slices.Contains(methods, method) {
+    fmt.Println("-method has to be one of " + strings.Join(methods, ", ") + ", not " + *methodFlag)
+    os.Exit(1)
+  }
+  correction, completeDeletion := ParseDistanceFlags(*correctionFlag, *gapsFlag)
+
+  speciesList, _ := LoadDatasets(flags.Arg(0))
+  root := DistanceTree(ComputeCorrectedDistances(speciesList, correction, completeDeletion), method)
+  WriteDistanceTree(root, *outputFlag)
+
+  if *scoreFlag {
+    config := LoadValidatedConfig(*configFlag, *presetFlag, overrides)
+    alignment := CompressSitePatterns(speciesList, config.sequenceLengthMax)
+    alignment.numChunks = config.siteThreads
+    root.model = NewSubstitutionModel(config.modelName, !config.gapsAsMissing)
+    root.model.SetRateHeterogeneity(config.gammaCategories, config.gammaAlpha, config.invariantProportion)
+    score := CalculateMaxLikelihoodScores(root, alignment)
+    fmt.Println(method + " tree: log likelihood " + strconv.FormatFloat(score, 'f', 6, 64) + " under " + root.model.Description())
+  }
+}
+
+// Prints the tree, and writes it to the file as well when one is given
+func WriteDistanceTree(root *node, filename string) {
+  newick := NewickFormatTreeRepresentation(root)
+  fmt.Println(newick)
+  if filename == "" {
+    return
+  }
+  if err := os.WriteFile(filename, []byte(newick + "\n"), 0644); err != nil {
+    fmt.Println("Something went wrong while trying to write the tree file:" + filename)
+    os.Exit(1)
+  }
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+  "encoding/csv"
+  "fmt"
+  "io"
+  "math"
+  "os"
+  "slices"
+  "strconv"
+  "strings"
+
+  "gonum.org/v1/gonum/mat"
+)
+
+// The corrections that turn the observed differences between two sequences into an evolutionary distance
+var distanceCorrections = []string{"p", "JC69", "K2P", "TN93", "LogDet"}
+
+// The index of a base within A, C, G and T, or -1 for gaps and ambiguous characters
+func BaseIndex(nct byte) int {
+  switch nct {
+  case 'A', 'a':
+    return 0
+  case 'C', 'c':
+    return 1
+  case 'G', 'g':
+    return 2
+  case 'T', 't', 'U', 'u':
+    return 3
+  }
+  return -1
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * Computes the distances between all pairs of sequences under the given correction. Only sites where the
+ * sequences hold one of the four bases are compared. With pairwise deletion a site is left out for a pair
+ * when either of the two has a gap or an ambiguous character there; with complete deletion it is left out
+ * for every pair as soon as any sequence has one. Pairs without any comparable site, or too different to
+ * be corrected, are set to the largest distance allowed.
+ *------------------------------------------------------------------------------------------------------*/
+func ComputeCorrectedDistances(speciesList []speciesGenome, correction string, completeDeletion bool) distanceMatrix {
+  numSpecies := len(speciesList)
+  matrix := distanceMatrix{names:make([]string, numSpecies), distances:make([][]float64, numSpecies)}
+  for i, species := range speciesList {
+    matrix.names[i] = species.name
+    matrix.distances[i] = make([]float64, numSpecies)
+  }
+
+  var sharedSites []bool
+  if completeDeletion {
+    sharedSites = CompleteDeletionSites(speciesList)
+    if !slices.Contains(sharedSites, true) && numSpecies > 1 {
+      fmt.Println("No site is left after the complete deletion of gaps and ambiguous characters")
+      os.Exit(1)
+    }
+  }
+  for i:=0; i<numSpecies; i++ {
+    for j:=i+1; j<numSpecies; j++ {
+      counts := PairSubstitutionCounts(speciesList[i].nucleotideSequence, speciesList[j].nucleotideSequence, sharedSites)
+      distance := CorrectedDistance(counts, correction)
+      if math.IsNaN(distance) || distance > maxEvolutionaryDistance {
+        distance = maxEvolutionaryDistance
+      }
+      // Rounding can leave identical sequences slightly below zero
+      distance = math.Max(distance, 0)
+      matrix.distances[i][j], matrix.distances[j][i] = distance, distance
+    }
+  }
+  return matrix
+}
+
+// The distances between the taxa of the site patterns, in the order of their indices, leaving out gaps and ambiguous characters pair by pair
+func PatternDistanceMatrix(alignment *sitePatterns, correction string) distanceMatrix {
+  numTaxa := alignment.NumTaxa()
+  matrix := distanceMatrix{names:make([]string, numTaxa), distances:make([][]float64, numTaxa)}
+  for name, index := range alignment.taxonIndices {
+    matrix.names[index] = name
+  }
+  for i:=0; i<numTaxa; i++ {
+    matrix.distances[i] = make([]float64, numTaxa)
+    for j:=0; j<i; j++ {
+      var counts [4][4]float64
+      for p, pattern := range alignment.patterns {
+        firstIndex, secondIndex := BaseIndex(pattern[i]), BaseIndex(pattern[j])
+        if firstIndex >= 0 && secondIndex >= 0 {
+          counts[firstIndex][secondIndex] += alignment.weights[p]
+        }
+      }
+      distance := CorrectedDistance(counts, correction)
+      if math.IsNaN(distance) || distance > maxEvolutionaryDistance {
+        distance = maxEvolutionaryDistance
+      }
+      matrix.distances[i][j] = math.Max(distance, 0)
+      matrix.distances[j][i] = matrix.distances[i][j]
+    }
+  }
+  return matrix
+}
+
+// The sites at which every sequence holds one of the four bases
+func CompleteDeletionSites(speciesList []speciesGenome) []bool {
+  if len(speciesList) == 0 {
+    return nil
+  }
+  numSites := math.MaxInt
+  for _, species := range speciesList {
+    numSites = min(numSites, len(species.nucleotideSequence))
+  }
+  sites := make([]bool, numSites)
+  for k := range sites {
+    sites[k] = true
+    for _, species := range speciesList {
+      if BaseIndex(species.nucleotideSequence[k]) < 0 {
+        sites[k] = false
+        break
+      }
+    }
+  }
+  return sites
+}
+
+// Counts how often every pair of bases faces each other in the two sequences, over the given sites or all of them when nil
+func PairSubstitutionCounts(first, second string, sites []bool) [4][4]float64 {
+  var counts [4][4]float64
+  for k:=0; k<len(first) && k<len(second); k++ {
+    if sites != nil && (k >= len(sites) || !sites[k]) {
+      continue
+    }
+    firstIndex, secondIndex := BaseIndex(first[k]), BaseIndex(second[k])
+    if firstIndex >= 0 && secondIndex >= 0 {
+      counts[firstIndex][secondIndex]++
+    }
+  }
+  return counts
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * Turns the counts of a pair of sequences into a distance:
+ *   p      - the plain proportion of differing sites, without any correction
+ *   JC69   - Jukes and Cantor (1969), for equal rates and base frequencies
+ *   K2P    - Kimura (1980), with separate rates for transitions and transversions
+ *   TN93   - Tamura and Nei (1993), with separate rates for the two kinds of transitions and the base
+ *            frequencies of the pair
+ *   LogDet - the paralinear distance of Lockhart et al. (1994), which stays consistent when the base
+ *            frequencies differ between the sequences
+ * Returns NaN when the sequences are too different for the correction.
+ *------------------------------------------------------------------------------------------------------*/
+func CorrectedDistance(counts [4][4]float64, correction string) float64 {
+  var numSites, purineTransitions, pyrimidineTransitions, transversions float64
+  var frequencies [4]float64
+  for i:=0; i<4; i++ {
+    for j:=0; j<4; j++ {
+      numSites += counts[i][j]
+      frequencies[i] += counts[i][j]
+      frequencies[j] += counts[i][j]
+      switch {
+      case i == j:
+      case (i == 0 && j == 2) || (i == 2 && j == 0):
+        purineTransitions += counts[i][j]
+      case (i == 1 && j == 3) || (i == 3 && j == 1):
+        pyrimidineTransitions += counts[i][j]
+      default:
+        transversions += counts[i][j]
+      }
+    }
+  }
+  if numSites == 0 {
+    return math.NaN()
+  }
+  P1, P2, Q := purineTransitions/numSites, pyrimidineTransitions/numSites, transversions/numSites
+  p := P1 + P2 + Q
+
+  switch correction {
+  case "p":
+    return p
+  case "JC69":
+    return JukesCantorDistance(p)
+  case "K2P":
+    return -0.5*math.Log(1 - 2*(P1+P2) - Q) - 0.25*math.Log(1 - 2*Q)
+  case "TN93":
+    for i := range frequencies {
+      frequencies[i] /= 2 * numSites
+    }
+    piA, piC, piG, piT := frequencies[0], frequencies[1], frequencies[2], frequencies[3]
+    piR, piY := piA + piG, piC + piT
+    if piR == 0 || piY == 0 {
+      return JukesCantorDistance(p)
+    }
+    // A kind of transition that can not happen for lack of its bases adds nothing to the distance
+    var distance float64
+    if piA*piG > 0 {
+      distance -= 2*piA*piG/piR * math.Log(1 - piR*P1/(2*piA*piG) - Q/(2*piR))
+    }
+    if piC*piT > 0 {
+      distance -= 2*piC*piT/piY * math.Log(1 - piY*P2/(2*piC*piT) - Q/(2*piY))
+    }
+    distance -= 2*(piR*piY - piA*piG*piY/piR - piC*piT*piR/piY) * math.Log(1 - Q/(2*piR*piY))
+    return distance
+  case "LogDet":
+    joint := mat.NewDense(4, 4, nil)
+    var logDetFirst, logDetSecond float64
+    for i:=0; i<4; i++ {
+      var rowSum, columnSum float64
+      for j:=0; j<4; j++ {
+        joint.Set(i, j, counts[i][j]/numSites)
+        rowSum += counts[i][j]/numSites
+        columnSum += counts[j][i]/numSites
+      }
+      logDetFirst += math.Log(rowSum)
+      logDetSecond += math.Log(columnSum)
+    }
+    logDet, sign := mat.LogDet(joint)
+    if sign <= 0 || math.IsInf(logDetFirst, 0) || math.IsInf(logDetSecond, 0) {
+      return math.NaN()
+    }
+    return -0.25 * (logDet - 0.5*(logDetFirst + logDetSecond))
+  }
+  return math.NaN()
+}
+
+func JukesCantorDistance(p float64) float64 {
+  return -0.75 * math.Log(1 - 4.0/3.0*p)
+}
+
+// The name of the correction as it is listed in distanceCorrections, whatever its case, or "" for an unknown one
+func CanonicalCorrection(name string) string {
+  for _, correction := range distanceCorrections {
+    if strings.EqualFold(correction, name) {
+      return correction
+    }
+  }
+  return ""
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * Writes the matrix in the PHYLIP format, ie. the number of taxa followed by a row per taxon with its
+ * name and all its distances. Names are padded to ten characters as in the strict format, but kept whole
+ * when they are longer, which the relaxed readers of most programs accept.
+ *------------------------------------------------------------------------------------------------------*/
+func WritePhylipDistances(writer io.Writer, matrix distanceMatrix) error {
+  var text strings.Builder
+  text.WriteString(strconv.Itoa(len(matrix.names)) + "\n")
+  for i, name := range matrix.names {
+    text.WriteString(fmt.Sprintf("%-10s", strings.ReplaceAll(name, " ", "_")))
+    for _, distance := range matrix.distances[i] {
+      text.WriteString(" " + strconv.FormatFloat(distance, 'f', 6, 64))
+    }
+    text.WriteString("\n")
+  }
+  _, err := io.WriteString(writer, text.String())
+  return err
+}
+
+// Writes the matrix as CSV, with the names of the taxa heading both the rows and the columns
+func WriteCSVDistances(writer io.Writer, matrix distanceMatrix) error {
+  csvWriter := csv.NewWriter(writer)
+  csvWriter.Write(append([]string{""}, matrix.names...))
+  for i, name := range matrix.names {
+    row := []string{name}
+    for _, distance := range matrix.distances[i] {
+      row = append(row, strconv.FormatFloat(distance, 'f', 6, 64))
+    }
+    csvWriter.Write(row)
+  }
+  csvWriter.Flush()
+  return csvWriter.Error()
+}
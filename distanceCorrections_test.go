@@ -0,0 +1,99 @@
+package main
+
+import (
+  "math"
+  "testing"
+)
+
+func TestCorrectedDistance(t *testing.T) {
+  // 120 sites with the same base frequencies and every kind of difference equally common, p = 0.3
+  var jukesCantorCounts [4][4]float64
+  for i:=0; i<4; i++ {
+    for j:=0; j<4; j++ {
+      jukesCantorCounts[i][j] = 3
+    }
+    jukesCantorCounts[i][i] = 21
+  }
+  // 100 sites with 10 A-G and 10 C-T transitions and 10 A-C transversions, p = 0.3
+  transitionCounts := [4][4]float64{
+    {20, 10, 10, 0},
+    {0, 15, 0, 10},
+    {0, 0, 20, 0},
+    {0, 0, 0, 15},
+  }
+
+  tests := []struct {
+    name string
+    counts [4][4]float64
+    correction string
+    expected float64
+  }{
+    {"p", transitionCounts, "p", 0.3},
+    // -3/4 ln(1 - 4/3*0.3) = -3/4 ln(0.6)
+    {"JC69", transitionCounts, "JC69", 0.38311921782449304},
+    // -1/2 ln(1 - 2*0.2 - 0.1) - 1/4 ln(1 - 2*0.1)
+    {"K2P", transitionCounts, "K2P", 0.40235947810852507},
+    // The base frequencies of the pair are 0.3, 0.25, 0.25 and 0.2
+    {"TN93", transitionCounts, "TN93", 0.40626053717479416},
+    // With equal frequencies and rates every correction comes down to JC69
+    {"K2P of JC69 counts", jukesCantorCounts, "K2P", 0.38311921782449304},
+    {"TN93 of JC69 counts", jukesCantorCounts, "TN93", 0.38311921782449304},
+    {"LogDet of JC69 counts", jukesCantorCounts, "LogDet", 0.38311921782449304},
+  }
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      if distance := CorrectedDistance(test.counts, test.correction); math.Abs(distance - test.expected) > 1e-12 {
+        t.Errorf("distance %v, expected %v", distance, test.expected)
+      }
+    })
+  }
+}
+
+func TestCorrectedDistanceOfSaturatedSequences(t *testing.T) {
+  // Six out of seven sites differ, more than even unrelated sequences do
+  var counts [4][4]float64
+  for i:=0; i<4; i++ {
+    for j:=0; j<4; j++ {
+      counts[i][j] = 2
+    }
+    counts[i][i] = 1
+  }
+  for _, correction := range []string{"JC69", "K2P", "LogDet"} {
+    if distance := CorrectedDistance(counts, correction); !math.IsNaN(distance) {
+      t.Errorf("%s: distance %v, expected NaN", correction, distance)
+    }
+  }
+  if distance := CorrectedDistance([4][4]float64{}, "p"); !math.IsNaN(distance) {
+    t.Errorf("distance %v without any site, expected NaN", distance)
+  }
+}
+
+func TestComputeCorrectedDistances(t *testing.T) {
+  speciesList := []speciesGenome{
+    {name:"x", nucleotideSequence:"ACGTACGTAC"},
+    {name:"y", nucleotideSequence:"ACGTACGTAA"},
+    {name:"z", nucleotideSequence:"AC-TACGTAN"},
+  }
+  tests := []struct {
+    name string
+    completeDeletion bool
+    expected [][]float64
+  }{
+    // x and y are compared over all ten sites, the pairs with z over eight
+    {"pairwise deletion", false, [][]float64{{0, 0.1, 0}, {0.1, 0, 0}, {0, 0, 0}}},
+    // Only the eight sites where every sequence has a base are left, so the difference of x and y is lost
+    {"complete deletion", true, [][]float64{{0, 0, 0}, {0, 0, 0}, {0, 0, 0}}},
+  }
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      matrix := ComputeCorrectedDistances(speciesList, "p", test.completeDeletion)
+      for i := range test.expected {
+        for j := range test.expected[i] {
+          if math.Abs(matrix.distances[i][j] - test.expected[i][j]) > 1e-12 {
+            t.Errorf("distance of %s and %s %v, expected %v", matrix.names[i], matrix.names[j], matrix.distances[i][j], test.expected[i][j])
+          }
+        }
+      }
+    })
+  }
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+  "fmt"
+  "math"
+  "os"
+  "strconv"
+)
+
+/*-------------------------------------------------------------------------------------------------------
+ * The distance criteria, which compare the tree with the pairwise distances of the alignment under the
+ * correction of ga.algo.params.distance.correction. The distances are only computed once, when the scorer
+ * is set up for a run.
+ *------------------------------------------------------------------------------------------------------*/
+type leastSquaresScorer struct {
+  matrix distanceMatrix
+}
+
+type minimumEvolutionScorer struct {
+  matrix distanceMatrix
+}
+
+func NewLeastSquaresScorer(config *gaConfig, alignment *sitePatterns) treeScorer {
+  return leastSquaresScorer{matrix:PatternDistanceMatrix(alignment, CanonicalCorrection(config.distanceCorrection))}
+}
+
+func NewMinimumEvolutionScorer(config *gaConfig, alignment *sitePatterns) treeScorer {
+  return minimumEvolutionScorer{matrix:PatternDistanceMatrix(alignment, CanonicalCorrection(config.distanceCorrection))}
+}
+
+// The negative sum of the squared differences between the distances and the path lengths of the tree
+func (scorer leastSquaresScorer) Score(root *node, alignment *sitePatterns) float64 {
+  pathLengths, _ := LeafPairPaths(root, alignment)
+  var sumOfSquares float64
+  for i := range pathLengths {
+    for j:=0; j<i; j++ {
+      sumOfSquares += math.Pow(scorer.matrix.distances[i][j] - pathLengths[i][j], 2)
+    }
+  }
+  return -sumOfSquares
+}
+
+func (scorer leastSquaresScorer) Describe(score float64) string {
+  return "Least-squares error: " + strconv.FormatFloat(-score, 'f', 6, 64)
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * The negative balanced minimum evolution length of the tree (Pauplin, 2000), ie. the sum of the distances
+ * weighted by 2^(1-k) for a pair of taxa k branches apart in the unrooted tree. This is the length the
+ * tree would have with branch lengths fitted to the distances, so only its topology matters.
+ *------------------------------------------------------------------------------------------------------*/
+func (scorer minimumEvolutionScorer) Score(root *node, alignment *sitePatterns) float64 {
+  _, pathEdges := LeafPairPaths(root, alignment)
+  var treeLength float64
+  for i := range pathEdges {
+    for j:=0; j<i; j++ {
+      treeLength += math.Pow(2, float64(1 - pathEdges[i][j])) * scorer.matrix.distances[i][j]
+    }
+  }
+  return -treeLength
+}
+
+func (scorer minimumEvolutionScorer) Describe(score float64) string {
+  return "Minimum evolution tree length: " + strconv.FormatFloat(-score, 'f', 6, 64)
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * The length of the path between every pair of leaves along with the number of branches on it, indexed by
+ * the taxa of the alignment. The two branches below the root count as a single one, as they are in the
+ * unrooted tree.
+ *------------------------------------------------------------------------------------------------------*/
+func LeafPairPaths(root *node, alignment *sitePatterns) ([][]float64, [][]int) {
+  numTaxa := alignment.NumTaxa()
+  pathLengths, pathEdges := make([][]float64, numTaxa), make([][]int, numTaxa)
+  for i:=0; i<numTaxa; i++ {
+    pathLengths[i], pathEdges[i] = make([]float64, numTaxa), make([]int, numTaxa)
+  }
+
+  type leafPath struct {
+    index int
+    length float64
+    edges int
+  }
+  var collectPaths func(currNode *node) []leafPath
+  collectPaths = func(currNode *node) []leafPath {
+    if currNode.leftChild == nil && currNode.rightChild == nil {
+      index, exists := alignment.taxonIndices[currNode.name]
+      if !exists {
+        fmt.Println("Invalid Tree or Map present")
+        os.Exit(1)
+      }
+      return []leafPath{{index:index}}
+    }
+    leftPaths, rightPaths := collectPaths(currNode.leftChild), collectPaths(currNode.rightChild)
+    for k := range leftPaths {
+      leftPaths[k].length += currNode.leftChildDistance
+      leftPaths[k].edges++
+    }
+    for k := range rightPaths {
+      rightPaths[k].length += currNode.rightChildDistance
+      rightPaths[k].edges++
+    }
+    for _, left := range leftPaths {
+      for _, right := range rightPaths {
+        edges := left.edges + right.edges
+        if currNode == root {
+          edges--
+        }
+        pathLengths[left.index][right.index], pathLengths[right.index][left.index] = left.length + right.length, left.length + right.length
+        pathEdges[left.index][right.index], pathEdges[right.index][left.index] = edges, edges
+      }
+    }
+    return append(leftPaths, rightPaths...)
+  }
+  collectPaths(root)
+  return pathLengths, pathEdges
+}
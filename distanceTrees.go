@@ -0,0 +1,207 @@
+package main
+
+import (
+  "math"
+  "strings"
+)
+
+// Distances beyond which the sequences are taken to be saturated, ie. when no correction is possible any more
+const maxEvolutionaryDistance = 5.0
+
+// The pairwise evolutionary distances between the taxa, in the order of their names
+type distanceMatrix struct {
+  names []string
+  distances [][]float64
+}
+
+// The Jukes-Cantor (JC69) distances between all pairs of sequences, leaving out gaps and ambiguous characters pair by pair
+func ComputeDistanceMatrix(speciesList []speciesGenome) distanceMatrix {
+  return ComputeCorrectedDistances(speciesList, "JC69", false)
+}
+
+// A copy of the distances that the tree building algorithms can change freely
+func (matrix distanceMatrix) CopyDistances() [][]float64 {
+  distances := make([][]float64, len(matrix.distances))
+  for i := range matrix.distances {
+    distances[i] = append(make([]float64, 0, len(matrix.distances[i])), matrix.distances[i]...)
+  }
+  return distances
+}
+
+// A separate leaf for every taxon of the matrix
+func (matrix distanceMatrix) Leaves() []*node {
+  leaves := make([]*node, len(matrix.names))
+  for i, name := range matrix.names {
+    leaves[i] = &node{name:name}
+  }
+  return leaves
+}
+
+// Joins two subtrees under a new ancestral node; negative branch lengths, which the distance methods can yield, are set to zero
+func JoinSubtrees(left, right *node, leftDistance, rightDistance float64) *node {
+  ancestralNode := &node{name:"Ancestor", leftChild:left, rightChild:right,
+                         leftChildDistance:math.Max(leftDistance, 0), rightChildDistance:math.Max(rightDistance, 0)}
+  left.parent, right.parent = ancestralNode, ancestralNode
+  return ancestralNode
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * Builds a tree from the distances by Neighbor-Joining (Saitou and Nei, 1987). At every step the pair of
+ * clusters minimizing the Q criterion is joined, until only two are left; these become the children of
+ * the root, which splits the last branch in half. The tree is unrooted in nature, so the position of
+ * the root carries no meaning.
+ *------------------------------------------------------------------------------------------------------*/
+func NeighborJoiningTree(matrix distanceMatrix) *node {
+  return JoinNeighbors(matrix, false)
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * Builds a tree by BIONJ (Gascuel, 1997), which picks the pairs and branch lengths like Neighbor-Joining
+ * but keeps track of the variances of the distances. The distances to a new cluster weigh those of its
+ * two parts by how reliable they are, rather than taking their plain average, which makes the tree more
+ * accurate when the distances are large.
+ *------------------------------------------------------------------------------------------------------*/
+func BIONJTree(matrix distanceMatrix) *node {
+  return JoinNeighbors(matrix, true)
+}
+
+// The distance based tree building methods, by the names they are chosen with
+func DistanceTree(matrix distanceMatrix, method string) *node {
+  switch strings.ToUpper(method) {
+  case "BIONJ":
+    return BIONJTree(matrix)
+  case "UPGMA":
+    return UPGMATree(matrix)
+  case "WPGMA":
+    return WPGMATree(matrix)
+  }
+  return NeighborJoiningTree(matrix)
+}
+
+// Neighbor-Joining, where the distances to a new cluster are either averaged or, for BIONJ, weighted by their variances
+func JoinNeighbors(matrix distanceMatrix, bionj bool) *node {
+  clusters := matrix.Leaves()
+  distances := matrix.CopyDistances()
+  // The variances of the distances start out proportional to the distances themselves
+  variances := matrix.CopyDistances()
+  if len(clusters) == 1 {
+    return clusters[0]
+  }
+
+  for len(clusters) > 2 {
+    numClusters := len(clusters)
+    rowSums := make([]float64, numClusters)
+    for i:=0; i<numClusters; i++ {
+      for k:=0; k<numClusters; k++ {
+        rowSums[i] += distances[i][k]
+      }
+    }
+    bestI, bestJ, bestQ := 0, 1, math.Inf(1)
+    for i:=0; i<numClusters; i++ {
+      for j:=i+1; j<numClusters; j++ {
+        q := float64(numClusters-2)*distances[i][j] - rowSums[i] - rowSums[j]
+        if q < bestQ {
+          bestI, bestJ, bestQ = i, j, q
+        }
+      }
+    }
+
+    distanceI := distances[bestI][bestJ]/2 + (rowSums[bestI] - rowSums[bestJ])/float64(2*(numClusters-2))
+    distanceJ := distances[bestI][bestJ] - distanceI
+    // Plain Neighbor-Joining gives both clusters the same weight
+    lambda := 0.5
+    if bionj && variances[bestI][bestJ] > 0 {
+      var varianceDifference float64
+      for k:=0; k<numClusters; k++ {
+        if k != bestI && k != bestJ {
+          varianceDifference += variances[bestJ][k] - variances[bestI][k]
+        }
+      }
+      lambda = math.Min(math.Max(0.5 + varianceDifference/(2*float64(numClusters-2)*variances[bestI][bestJ]), 0), 1)
+    }
+
+    clusters[bestI] = JoinSubtrees(clusters[bestI], clusters[bestJ], distanceI, distanceJ)
+    for k:=0; k<numClusters; k++ {
+      if k != bestI && k != bestJ {
+        distances[bestI][k] = lambda*(distances[bestI][k] - distanceI) + (1-lambda)*(distances[bestJ][k] - distanceJ)
+        distances[k][bestI] = distances[bestI][k]
+        variances[bestI][k] = lambda*variances[bestI][k] + (1-lambda)*variances[bestJ][k] - lambda*(1-lambda)*variances[bestI][bestJ]
+        variances[k][bestI] = variances[bestI][k]
+      }
+    }
+    clusters, distances = RemoveCluster(clusters, distances, bestJ)
+    variances = RemoveRowAndColumn(variances, bestJ)
+  }
+  return JoinSubtrees(clusters[0], clusters[1], distances[0][1]/2, distances[0][1]/2)
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * Builds a rooted tree from the distances by UPGMA: the two closest clusters are joined at half their
+ * distance, and the distance of the new cluster to every other one is the average over all the taxa
+ * they hold. Every leaf ends up at the same distance from the root.
+ *------------------------------------------------------------------------------------------------------*/
+func UPGMATree(matrix distanceMatrix) *node {
+  return ClusterTree(matrix, false)
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * Builds a rooted tree by WPGMA, which only differs from UPGMA in giving both of the joined clusters the
+ * same weight in the distances to the new cluster, whatever the number of taxa they hold
+ *------------------------------------------------------------------------------------------------------*/
+func WPGMATree(matrix distanceMatrix) *node {
+  return ClusterTree(matrix, true)
+}
+
+// Average linkage clustering, where the distances to a new cluster are averaged either over its taxa or over its two parts
+func ClusterTree(matrix distanceMatrix, weighted bool) *node {
+  clusters := matrix.Leaves()
+  distances := matrix.CopyDistances()
+  heights := make([]float64, len(clusters))
+  sizes := make([]float64, len(clusters))
+  for i := range sizes {
+    sizes[i] = 1
+  }
+
+  for len(clusters) > 1 {
+    numClusters := len(clusters)
+    bestI, bestJ := 0, 1
+    for i:=0; i<numClusters; i++ {
+      for j:=i+1; j<numClusters; j++ {
+        if distances[i][j] < distances[bestI][bestJ] {
+          bestI, bestJ = i, j
+        }
+      }
+    }
+
+    height := distances[bestI][bestJ] / 2
+    clusters[bestI] = JoinSubtrees(clusters[bestI], clusters[bestJ], height - heights[bestI], height - heights[bestJ])
+    weightI, weightJ := sizes[bestI], sizes[bestJ]
+    if weighted {
+      weightI, weightJ = 1, 1
+    }
+    for k:=0; k<numClusters; k++ {
+      if k != bestI && k != bestJ {
+        distances[bestI][k] = (weightI*distances[bestI][k] + weightJ*distances[bestJ][k]) / (weightI + weightJ)
+        distances[k][bestI] = distances[bestI][k]
+      }
+    }
+    heights[bestI], sizes[bestI] = height, sizes[bestI] + sizes[bestJ]
+    heights = append(heights[:bestJ], heights[bestJ+1:]...)
+    sizes = append(sizes[:bestJ], sizes[bestJ+1:]...)
+    clusters, distances = RemoveCluster(clusters, distances, bestJ)
+  }
+  return clusters[0]
+}
+
+// Drops the cluster at the given index along with its row and column of the distances
+func RemoveCluster(clusters []*node, distances [][]float64, index int) ([]*node, [][]float64) {
+  return append(clusters[:index], clusters[index+1:]...), RemoveRowAndColumn(distances, index)
+}
+
+func RemoveRowAndColumn(values [][]float64, index int) [][]float64 {
+  values = append(values[:index], values[index+1:]...)
+  for i := range values {
+    values[i] = append(values[i][:index], values[i][index+1:]...)
+  }
+  return values
+}
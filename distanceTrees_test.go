@@ -0,0 +1,177 @@
+package main
+
+import (
+  "math"
+  "testing"
+)
+
+/*-------------------------------------------------------------------------------------------------------
+ * The five taxa example of Neighbor-Joining found in most textbooks. The distances are additive, being the
+ * path lengths of the tree ((a:2,b:3):3,c:4,(d:2,e:1):2), so both NJ and BIONJ have to recover this tree
+ * along with all of its branch lengths.
+ *------------------------------------------------------------------------------------------------------*/
+var additiveMatrix = distanceMatrix{
+  names: []string{"a", "b", "c", "d", "e"},
+  distances: [][]float64{
+    {0, 5, 9, 9, 8},
+    {5, 0, 10, 10, 9},
+    {9, 10, 0, 8, 7},
+    {9, 10, 8, 0, 3},
+    {8, 9, 7, 3, 0},
+  },
+}
+
+// The length of the path between every pair of leaves of the tree, keyed by their names
+func PathLengths(root *node) map[[2]string]float64 {
+  // The distance of every node from the root, and the ancestors of every leaf from the deepest one up
+  depths := make(map[*node]float64)
+  leafAncestors := make(map[string][]*node)
+  var visit func(currNode *node, depth float64) []*node
+  visit = func(currNode *node, depth float64) []*node {
+    depths[currNode] = depth
+    if currNode.leftChild == nil && currNode.rightChild == nil {
+      return []*node{currNode}
+    }
+    leaves := append(visit(currNode.leftChild, depth + currNode.leftChildDistance),
+                     visit(currNode.rightChild, depth + currNode.rightChildDistance)...)
+    for _, leaf := range leaves {
+      leafAncestors[leaf.name] = append(leafAncestors[leaf.name], currNode)
+    }
+    return leaves
+  }
+  leaves := visit(root, 0)
+
+  // The path between two leaves goes through their deepest common ancestor
+  lengths := make(map[[2]string]float64)
+  for _, first := range leaves {
+    for _, second := range leaves {
+      if first == second {
+        continue
+      }
+      for _, ancestor := range leafAncestors[first.name] {
+        if ContainsNode(leafAncestors[second.name], ancestor) {
+          lengths[[2]string{first.name, second.name}] = depths[first] + depths[second] - 2*depths[ancestor]
+          break
+        }
+      }
+    }
+  }
+  return lengths
+}
+
+func ContainsNode(nodes []*node, wanted *node) bool {
+  for _, currNode := range nodes {
+    if currNode == wanted {
+      return true
+    }
+  }
+  return false
+}
+
+// Fails the test unless the path lengths of the tree are the given distances
+func CheckPathLengths(t *testing.T, root *node, matrix distanceMatrix) {
+  t.Helper()
+  lengths := PathLengths(root)
+  if len(lengths) != len(matrix.names)*(len(matrix.names)-1) {
+    t.Fatalf("the tree has the leaves of %d pairs of taxa, expected %d", len(lengths), len(matrix.names)*(len(matrix.names)-1))
+  }
+  for i, first := range matrix.names {
+    for j, second := range matrix.names {
+      if i == j {
+        continue
+      }
+      if length, found := lengths[[2]string{first, second}]; !found || math.Abs(length - matrix.distances[i][j]) > 1e-12 {
+        t.Errorf("the path from %s to %s has length %v, expected %v", first, second, length, matrix.distances[i][j])
+      }
+    }
+  }
+}
+
+func FindLeaf(root *node, name string) *node {
+  if root.leftChild == nil && root.rightChild == nil {
+    if root.name == name {
+      return root
+    }
+    return nil
+  }
+  if leaf := FindLeaf(root.leftChild, name); leaf != nil {
+    return leaf
+  }
+  return FindLeaf(root.rightChild, name)
+}
+
+func TestNeighborJoiningRecoversAdditiveTree(t *testing.T) {
+  for _, method := range []string{"NJ", "BIONJ"} {
+    t.Run(method, func(t *testing.T) {
+      root := DistanceTree(additiveMatrix, method)
+      CheckPathLengths(t, root, additiveMatrix)
+      // a and b are the first pair to be joined
+      if parent := FindLeaf(root, "a").parent; parent.leftChild.name != "b" && parent.rightChild.name != "b" {
+        t.Errorf("a and b were not joined")
+      }
+      // The root only splits one of the branches, so the lengths of the tree add up to those of the textbook
+      if total := TotalBranchLength(root); math.Abs(total - 17) > 1e-12 {
+        t.Errorf("the branch lengths add up to %v, expected 17", total)
+      }
+    })
+  }
+}
+
+func TestNeighborJoiningOfTwoAndThreeTaxa(t *testing.T) {
+  pair := distanceMatrix{names:[]string{"x", "y"}, distances:[][]float64{{0, 0.4}, {0.4, 0}}}
+  CheckPathLengths(t, NeighborJoiningTree(pair), pair)
+  triple := distanceMatrix{names:[]string{"x", "y", "z"}, distances:[][]float64{{0, 0.3, 0.5}, {0.3, 0, 0.6}, {0.5, 0.6, 0}}}
+  for _, method := range []string{"NJ", "BIONJ"} {
+    CheckPathLengths(t, DistanceTree(triple, method), triple)
+  }
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * a and b are joined at a height of 1 and c joins them at 2 under both methods. The distance of d to the
+ * cluster of all three is the average over the taxa for UPGMA, (2*8 + 14)/3 = 10, but the average of the
+ * two parts for WPGMA, (8 + 14)/2 = 11, which puts the root at a height of 5 or 5.5.
+ *------------------------------------------------------------------------------------------------------*/
+func TestAverageLinkageTrees(t *testing.T) {
+  matrix := distanceMatrix{
+    names: []string{"a", "b", "c", "d"},
+    distances: [][]float64{
+      {0, 2, 4, 8},
+      {2, 0, 4, 8},
+      {4, 4, 0, 14},
+      {8, 8, 14, 0},
+    },
+  }
+  tests := []struct {
+    method string
+    rootHeight float64
+  }{
+    {"UPGMA", 5},
+    {"WPGMA", 5.5},
+  }
+  for _, test := range tests {
+    t.Run(test.method, func(t *testing.T) {
+      root := DistanceTree(matrix, test.method)
+      throughRoot := 2*test.rootHeight
+      CheckPathLengths(t, root, distanceMatrix{names:matrix.names, distances:[][]float64{
+        {0, 2, 4, throughRoot},
+        {2, 0, 4, throughRoot},
+        {4, 4, 0, throughRoot},
+        {throughRoot, throughRoot, throughRoot, 0},
+      }})
+      // Every leaf is at the same distance from the root
+      for _, name := range matrix.names {
+        var depth float64
+        for leaf := FindLeaf(root, name); leaf.parent != nil; leaf = leaf.parent {
+          if leaf.parent.leftChild == leaf {
+            depth += leaf.parent.leftChildDistance
+          } else {
+            depth += leaf.parent.rightChildDistance
+          }
+        }
+        if depth != test.rootHeight {
+          t.Errorf("%s is at a distance of %v from the root, expected %v", name, depth, test.rootHeight)
+        }
+      }
+    })
+  }
+}
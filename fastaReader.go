@@ -0,0 +1,59 @@
+package main
+
+import (
+  "fmt"
+  "os"
+  "strconv"
+  "strings"
+)
+
+/*-------------------------------------------------------------------------------------------------------
+ * Parses FASTA alignments as produced by MAFFT, MUSCLE and most other aligners. Every record starts with
+ * a '>' header whose first word is used as the species name; anything after it is treated as a free text
+ * description. The sequence of a record may be spread over any number of lines.
+ *------------------------------------------------------------------------------------------------------*/
+func ParseFastaAlignment(lines []string) parsedAlignment {
+  alignment := NewParsedAlignment()
+  var currName string
+  var currLine int
+  var currSequence strings.Builder
+  inRecord := false
+
+  for i, line := range lines {
+    line = strings.TrimSpace(line)
+    // Empty lines and the old style ';' comment lines carry no sequence information
+    if line == "" || strings.HasPrefix(line, ";") {
+      continue
+    }
+    if strings.HasPrefix(line, ">") {
+      if inRecord {
+        alignment.AddSequence(currName, currSequence.String(), currLine)
+      }
+      headerInfo := strings.Fields(line[1:])
+      if len(headerInfo) == 0 {
+        fmt.Println("Invalid FASTA format; missing sequence name in header at line:" + strconv.Itoa(i+1))
+        os.Exit(1)
+      }
+      currName, currLine = headerInfo[0], i+1
+      currSequence.Reset()
+      inRecord = true
+      continue
+    }
+    if !inRecord {
+      fmt.Println("Invalid FASTA format; sequence data found before the first header at line:" + strconv.Itoa(i+1))
+      os.Exit(1)
+    }
+    for _, field := range strings.Fields(line) {
+      currSequence.WriteString(field)
+    }
+  }
+  if inRecord {
+    alignment.AddSequence(currName, currSequence.String(), currLine)
+  }
+
+  if len(alignment.speciesList) == 0 {
+    fmt.Println("Invalid FASTA format; no sequences were found in the input file")
+    os.Exit(1)
+  }
+  return alignment
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+  "strings"
+  "testing"
+)
+
+// Fails the test unless the parsed species hold exactly the expected names and sequences, in the same order
+func CheckSpeciesList(t *testing.T, speciesList []speciesGenome, expected []speciesGenome) {
+  t.Helper()
+  if len(speciesList) != len(expected) {
+    t.Fatalf("parsed %d sequences, expected %d: %v", len(speciesList), len(expected), speciesList)
+  }
+  for i := range expected {
+    if speciesList[i] != expected[i] {
+      t.Errorf("sequence %d is %v, expected %v", i+1, speciesList[i], expected[i])
+    }
+  }
+}
+
+func TestParseFastaAlignment(t *testing.T) {
+  tests := []struct {
+    name string
+    text string
+    expected []speciesGenome
+  }{
+    {"single line records", ">human\nACGT\n>chimp\nACGA\n",
+     []speciesGenome{{"human", "ACGT"}, {"chimp", "ACGA"}}},
+    {"multi-line records", ">human description of the sequence\nAC\nGT\nAA\n>chimp\nACG\nTAA\n",
+     []speciesGenome{{"human", "ACGTAA"}, {"chimp", "ACGTAA"}}},
+    {"blank and comment lines", "\n>human\nAC GT\n\n; an old style comment\nAA\n\n>chimp\n\nACGTAA\n\n",
+     []speciesGenome{{"human", "ACGTAA"}, {"chimp", "ACGTAA"}}},
+    {"windows line endings", ">human\r\nACGT\r\n>chimp\r\nAC-T\r\n",
+     []speciesGenome{{"human", "ACGT"}, {"chimp", "AC-T"}}},
+  }
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      CheckSpeciesList(t, ParseFastaAlignment(strings.Split(test.text, "\n")).speciesList, test.expected)
+    })
+  }
+}
+
+func TestDetectAlignmentFormat(t *testing.T) {
+  tests := []struct {
+    filename string
+    text string
+    expected string
+  }{
+    {"primates.fasta", "2\nhuman ACGT\nchimp ACGA", "fasta"},
+    {"primates.FA", "", "fasta"},
+    {"primates.txt", "\n>human\nACGT", "fasta"},
+    {"primates.txt", "2\nhuman ACGT\nchimp ACGA", "counted"},
+  }
+  for _, test := range tests {
+    if format := DetectAlignmentFormat(test.filename, strings.Split(test.text, "\n")); format != test.expected {
+      t.Errorf("%s holding %q was detected as %s, expected %s", test.filename, test.text, format, test.expected)
+    }
+  }
+}
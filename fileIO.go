@@ -6,144 +6,154 @@ import(
   "bufio"
   "strings"
   "strconv"
+  "path/filepath"
 )
 
-var stringConfigs map[string]string
-var floatConfigs map[string]float64
-var intConfigs map[string]int
-var isLoaded bool
-
 /*-------------------------------------------------------------------------------
  * A basic function for loading the information of the aligned gene sequences for
- * the phylogenetic tree reconstruction.
+ * the phylogenetic tree reconstruction. The format of the file is detected from its
+ * extension or contents, so the original count-prefixed files as well as FASTA,
+ * PHYLIP and NEXUS alignments can be used directly. The alignment is validated
+ * before it is handed over to the rest of the program.
  *------------------------------------------------------------------------------*/
 func LoadDatasets(filename string) ([]speciesGenome, map[string]speciesGenome) {
+  lines := ReadDatasetLines(filename)
+
+  var alignment parsedAlignment
+  switch DetectAlignmentFormat(filename, lines) {
+  case "fasta":
+    alignment = ParseFastaAlignment(lines)
+  case "phylip":
+    alignment = ParsePhylipAlignment(lines)
+  case "nexus":
+    alignment, _ = ParseNexusFile(lines)
+  default:
+    alignment = ParseCountPrefixedAlignment(lines)
+  }
+
+  // Every problem of the alignment is reported at once, before any of the GA work can start
+  diagnostics := ValidateAlignment(alignment)
+  if len(diagnostics) > 0 {
+    ReportAlignmentDiagnostics(filename, diagnostics)
+    os.Exit(1)
+  }
+
+  speciesMap := make(map[string]speciesGenome)
+  for _, species := range alignment.speciesList {
+    speciesMap[species.name] = species
+  }
+  return alignment.speciesList, speciesMap
+}
+
+/*-------------------------------------------------------------------------------
+ * Reads the complete input file into memory line by line. Aligned sequences can get
+ * quite long, so the scanner buffer is enlarged beyond its default token size.
+ *------------------------------------------------------------------------------*/
+func ReadDatasetLines(filename string) []string {
   file, err := os.Open(filename)
   if err != nil {
     fmt.Println("Something went wrong while trying to open the input file:" + filename)
     os.Exit(1)
   }
+  lines := make([]string, 0)
   scanner := bufio.NewScanner(file)
-  scanner.Scan()
-  speciesCount, err := strconv.Atoi(scanner.Text())
-  if err != nil {
-    fmt.Println("Invalid format of the input file; needs to begin with a number describing the number of aligned sequences")
-    os.Exit(1)
-  }
-
-  speciesList := make([]speciesGenome, speciesCount)
-  speciesMap := make(map[string]speciesGenome)
-  for i:=0; i<speciesCount; i++ {
-    scanner.Scan()
-    lineInfo := strings.Split(scanner.Text(), " ")
-    if len(lineInfo) != 2 {
-      fmt.Println("Invalid format of the input file; Additional space characters found in line:" + strconv.Itoa(i+2))
-      os.Exit(1)
-    }
-    speciesList[i] = speciesGenome{name:lineInfo[0], nucleotideSequence:lineInfo[1]}
-    speciesMap[lineInfo[0]] = speciesGenome{name:lineInfo[0], nucleotideSequence:lineInfo[1]}
+  scanner.Buffer(make([]byte, 0, 1024*1024), 64*1024*1024)
+  for scanner.Scan() {
+    lines = append(lines, strings.TrimRight(scanner.Text(), "\r"))
   }
   file.Close()
   if scanner.Err() != nil {
     fmt.Println("Something went wrong while trying to read the input file:" + filename)
     os.Exit(1)
   }
-  return speciesList, speciesMap
+  return lines
 }
 
-/*---------------------------------------------------------------------------------
- * Since there have been a lot of variable parameter for the algorithm, I have decided
- * that moving forward with a config style approach would be more convenient rather than
- * using the traditional command line approach
- *------------------------------------------------------------------------------------*/
-func LoadConfigs() {
-  file, err := os.Open("config.txt")
-  if err != nil {
-    fmt.Println("Something went wrong while trying to read the input file:config.txt")
-    os.Exit(1)
+/*-------------------------------------------------------------------------------
+ * Decides which parser should be used for the given file. Well known extensions are
+ * trusted first; otherwise the first non-empty line of the file is inspected.
+ *------------------------------------------------------------------------------*/
+func DetectAlignmentFormat(filename string, lines []string) string {
+  switch strings.ToLower(filepath.Ext(filename)) {
+  case ".fasta", ".fas", ".fa", ".fna", ".ffn", ".afa", ".mfa":
+    return "fasta"
+  case ".phy", ".phylip":
+    return "phylip"
+  case ".nex", ".nexus", ".nxs":
+    return "nexus"
   }
-  stringConfigs = make(map[string]string)
-  floatConfigs  = make(map[string]float64)
-  intConfigs    = make(map[string]int)
-
-  scanner := bufio.NewScanner(file)
-  for scanner.Scan(){
-    property := strings.Split(scanner.Text(),"=")
-    if len(property) != 2 {
-      fmt.Println("Invalid format for configFile of line:" + scanner.Text())
-      os.Exit(1)
+  for _, line := range lines {
+    line = strings.TrimSpace(line)
+    if line == "" {
+      continue
     }
-    val := strings.Split(property[1], ",")
-    if len(val) != 2 {
-      fmt.Println("Invalid format for configFile of line:" + scanner.Text())
-      os.Exit(1)
+    if strings.HasPrefix(line, ">") {
+      return "fasta"
     }
-
-    switch val[1] {
-    case "int":
-      intVal, err := strconv.Atoi(val[0])
-      if err != nil {
-        fmt.Println("Error while writing int value for: " + scanner.Text())
-      }
-      intConfigs[property[0]] = intVal
-
-    case "float64":
-      floatVal, err := strconv.ParseFloat(val[0], 64)
-      if err != nil {
-        fmt.Println("Error while writing int value for: " + scanner.Text())
+    if strings.EqualFold(line, "#NEXUS") {
+      return "nexus"
+    }
+    // A PHYLIP header holds both the number of taxa and sites, whereas the original format only
+    // begins with the number of sequences
+    headerInfo := strings.Fields(line)
+    if len(headerInfo) >= 2 {
+      _, err1 := strconv.Atoi(headerInfo[0])
+      _, err2 := strconv.Atoi(headerInfo[1])
+      if err1 == nil && err2 == nil {
+        return "phylip"
       }
-      floatConfigs[property[0]] = floatVal
-
-    case "string":
-      stringConfigs[property[0]] = val[0]
     }
+    break
   }
-  file.Close()
-  if scanner.Err() != nil {
-    fmt.Println("Something went wrong while trying to read the input file:config.txt")
-    os.Exit(1)
-  }
-  fmt.Println("Succesfully loaded data from config file into program")
+  return "counted"
 }
 
-/*--------------------------------------------------------------------------------------
- * Smaller set of functions to fetch different value types
- *-------------------------------------------------------------------------------------*/
-func LoadIntConfig(property string) int {
-  if !isLoaded {
-    LoadConfigs()
-    isLoaded = true
+/*-------------------------------------------------------------------------------
+ * The original input format of the project: a line holding the number of aligned
+ * sequences followed by one "name sequence" pair per line. Every non-empty line after
+ * the count is read, so that a wrong count can be reported by the validation.
+ *------------------------------------------------------------------------------*/
+func ParseCountPrefixedAlignment(lines []string) parsedAlignment {
+  if len(lines) == 0 {
+    fmt.Println("Invalid format of the input file; needs to begin with a number describing the number of aligned sequences")
+    os.Exit(1)
   }
-  retVal, exists := intConfigs[property]
-  if !exists {
-    fmt.Println("Invalid int property requested: " + property)
+  speciesCount, err := strconv.Atoi(strings.TrimSpace(lines[0]))
+  if err != nil {
+    fmt.Println("Invalid format of the input file; needs to begin with a number describing the number of aligned sequences")
     os.Exit(1)
   }
-  return retVal
-}
 
-func LoadFloatConfig(property string) float64 {
-  if !isLoaded {
-    LoadConfigs()
-    isLoaded = true
-  }
-  retVal, exists := floatConfigs[property]
-  if !exists {
-    fmt.Println("Invalid int property requested: " + property)
-    os.Exit(1)
+  alignment := NewParsedAlignment()
+  alignment.declaredCount, alignment.declarationLine = speciesCount, 1
+  for i:=1; i<len(lines); i++ {
+    if strings.TrimSpace(lines[i]) == "" {
+      continue
+    }
+    lineInfo := strings.Split(lines[i], " ")
+    if len(lineInfo) != 2 {
+      alignment.diagnostics = append(alignment.diagnostics, alignmentDiagnostic{line:i+1,
+                                     message:"additional space characters found; expected a single 'name sequence' pair"})
+      continue
+    }
+    alignment.AddSequence(lineInfo[0], lineInfo[1], i+1)
   }
-  return retVal
+  return alignment
 }
 
-func LoadStringConfig(property string) string {
-  if !isLoaded {
-    LoadConfigs()
-    isLoaded = true
+/*-------------------------------------------------------------------------------
+ * Loads the trees of a tree file, which is either a NEXUS file with a TREES block or
+ * a plain text file holding any number of Newick trees. The trees of a plain file
+ * are named after the file and their position in it.
+ *------------------------------------------------------------------------------*/
+func LoadNewickTrees(filename string) []referenceTree {
+  lines := ReadDatasetLines(filename)
+  if DetectAlignmentFormat(filename, lines) == "nexus" {
+    return LoadReferenceTrees(filename)
   }
-  retVal, exists := stringConfigs[property]
-  if !exists {
-    fmt.Println("Invalid int property requested: " + property)
-    os.Exit(1)
+  trees := make([]referenceTree, 0)
+  for i, newick := range SplitNewickTrees(strings.Join(lines, "\n")) {
+    trees = append(trees, referenceTree{name:filepath.Base(filename) + "#" + strconv.Itoa(i+1), newick:newick})
   }
-  return retVal
+  return trees
 }
@@ -0,0 +1,85 @@
+package main
+
+import (
+  "fmt"
+  "os"
+  "sort"
+  "strconv"
+  "strings"
+)
+
+/*-------------------------------------------------------------------------------------------------------
+ * Scores the trees of the GA. A higher score stands for a fitter tree, so criteria that are minimized,
+ * like parsimony, return their negative. Scorers are called from several goroutines at once and must not
+ * change the tree.
+ *------------------------------------------------------------------------------------------------------*/
+type treeScorer interface {
+  Score(root *node, alignment *sitePatterns) float64
+  // Writes out a score for the output of the run, ie. "Log likelihood: -1437.340000"
+  Describe(score float64) string
+}
+
+// Sets up a scorer for a run; anything that only depends on the alignment can be computed once here
+type treeScorerFactory func(config *gaConfig, alignment *sitePatterns) treeScorer
+
+/*-------------------------------------------------------------------------------------------------------
+ * The scorers that ga.algo.params.fitness can pick, by their name. Further ones are added with
+ * RegisterTreeScorer, ie. from the init function of a file of their own, without any change to the GA.
+ *------------------------------------------------------------------------------------------------------*/
+var treeScorers = map[string]treeScorerFactory{
+  "likelihood": func(config *gaConfig, alignment *sitePatterns) treeScorer { return likelihoodScorer{} },
+  "parsimony": func(config *gaConfig, alignment *sitePatterns) treeScorer { return parsimonyScorer{config:config} },
+  "least-squares": NewLeastSquaresScorer,
+  "minimum-evolution": NewMinimumEvolutionScorer,
+}
+
+func RegisterTreeScorer(name string, factory treeScorerFactory) {
+  if _, exists := treeScorers[name]; exists {
+    fmt.Println("The tree scorer " + name + " is registered more than once")
+    os.Exit(1)
+  }
+  treeScorers[name] = factory
+}
+
+// The names of all the registered scorers, in alphabetical order
+func TreeScorerNames() []string {
+  names := make([]string, 0, len(treeScorers))
+  for name := range treeScorers {
+    names = append(names, name)
+  }
+  sort.Strings(names)
+  return names
+}
+
+// The scorer chosen by the config, or an error when no scorer is registered under its name
+func NewTreeScorer(config *gaConfig, alignment *sitePatterns) (treeScorer, error) {
+  factory, exists := treeScorers[config.fitnessCriterion]
+  if !exists {
+    return nil, fmt.Errorf("ga.algo.params.fitness has to be one of %s, not %s", strings.Join(TreeScorerNames(), ", "), config.fitnessCriterion)
+  }
+  return factory(config, alignment), nil
+}
+
+// The log likelihood of the tree under its own substitution model
+type likelihoodScorer struct{}
+
+func (likelihoodScorer) Score(root *node, alignment *sitePatterns) float64 {
+  return CalculateMaxLikelihoodScores(root, alignment)
+}
+
+func (likelihoodScorer) Describe(score float64) string {
+  return "Log likelihood: " + strconv.FormatFloat(score, 'f', 6, 64)
+}
+
+// The negative parsimony score, so that fewer changes make a fitter tree
+type parsimonyScorer struct {
+  config *gaConfig
+}
+
+func (scorer parsimonyScorer) Score(root *node, alignment *sitePatterns) float64 {
+  return -ParsimonyScore(root, alignment, scorer.config)
+}
+
+func (scorer parsimonyScorer) Describe(score float64) string {
+  return "Parsimony score (" + scorer.config.parsimonyMethod + "): " + strconv.FormatFloat(-score, 'f', -1, 64)
+}
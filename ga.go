@@ -2,43 +2,50 @@ package main
 
 import(
   "fmt"
-  "time"
+  "os"
   "strconv"
-  "math/rand"
+  "math/rand/v2"
+  "runtime"
+  "sync"
 )
 
 /*-------------------------------------------------------------------------------------------------------
  * The core implementation of the GA algorithm, performs score calculations, population selection along with
  * the necessary mutations and crossovers. Also prints the generated outputs and other info with a
- * predetermined saampling rate.
+ * predetermined saampling rate. The run starts from the given state, which is either a fresh population or
+ * one restored from a checkpoint, and is itself saved to a checkpoint file at regular intervals. A signal
+ * received on the interrupts channel lets the current generation finish before the best tree is returned.
  *------------------------------------------------------------------------------------------------------*/
-func RunGASimulations(startingPopulation []*node, speciesMap map[string]speciesGenome,
-                      numGenerations, minStableGenerations int) *node {
+func RunGASimulations(config *gaConfig, state *gaState, alignment *sitePatterns, rng *rand.Rand, interrupts <-chan os.Signal) *node {
 
-  numSpecies := len(speciesMap)
+  numSpecies := alignment.NumTaxa()
+  startingPopulation := state.population
   numSolutions := len(startingPopulation)
+  numGenerations, minStableGenerations := config.generationsCount, config.stableGenerationsLimit
   fmt.Println("\nStarting the genetic algorithm with a population of " + strconv.Itoa(numSolutions) + " solutions over " + strconv.Itoa(numGenerations) + " generations")
 
-  fittestSurvivalReproductionRate := LoadFloatConfig("ga.algo.params.selection.proliferation.fraction")
+  fittestSurvivalReproductionRate := config.proliferationFraction
 
-  // Limiting the max sequence lengths for likelihood estimation.
-  var sequenceLength int
-  for _, val := range speciesMap {
-    sequenceLength = len(val.nucleotideSequence)
-    break
-  }
-  sequenceLimit := LoadIntConfig("ga.algo.params.sequencedata.length.max")
-  if sequenceLength > sequenceLimit {
-    sequenceLength = sequenceLimit
-  }
-
-  maxLikelihoodScores := make([]float64, numGenerations)
+  maxLikelihoodScores := state.maxLikelihoodScores
   var bestSolution *node
 
-  samplingRate := LoadIntConfig("ga.output.sampling.interval")
-  rand.Seed(time.Now().UTC().UnixNano())
+  checkpointInterval := config.checkpointInterval
+  checkpointFile := config.checkpointFile
+
+  // The trees are scored by the criterion of the config, which is looked up among the registered scorers
+  scorer, err := NewTreeScorer(config, alignment)
+  if err != nil {
+    fmt.Println(err)
+    os.Exit(1)
+  }
+
+  samplingRate := config.samplingInterval
+  numWorkers := config.threadsCount
+  if numWorkers <= 0 {
+    numWorkers = runtime.GOMAXPROCS(0)
+  }
 
-  for i:=0; i<numGenerations; i++ {
+  for i:=state.generation; i<numGenerations; i++ {
 
     printStatistics := false
     if i % samplingRate == 0 {
@@ -46,34 +53,78 @@ func RunGASimulations(startingPopulation []*node, speciesMap map[string]speciesG
       fmt.Println("Successfully completed " + strconv.Itoa(i) + " iterations.")
     }
 
-    likelihoodScores := make([]float64, numSolutions)
-    for j:=0; j<numSolutions; j++ {
-      likelihoodScores[j] = CalculateMaxLikelihoodScores(startingPopulation[j], speciesMap, sequenceLength)
-    }
+    fitnessScores := EvaluatePopulation(startingPopulation, alignment, scorer, numWorkers)
 
-    sortedLikelihoods, sortedPopulation := SortDescending(likelihoodScores, startingPopulation)
-    maxLikelihoodScores[i] = sortedLikelihoods[0]
+    sortedScores, sortedPopulation := SortDescending(fitnessScores, startingPopulation)
+    maxLikelihoodScores[i] = sortedScores[0]
     bestSolution = sortedPopulation[0]
     if printStatistics {
-      fmt.Print("The Likelihood score has been optimized to "); fmt.Println(sortedLikelihoods[0])
-      PrintNewickFormatTree(NewickFormatTreeRepresentation(bestSolution))
+      fmt.Println("The best score so far: " + scorer.Describe(sortedScores[0]))
+      PrintNewickFormatTree(NewickFormatTreeRepresentation(bestSolution), config.drawWidth, config.drawHeight)
     }
 
-    futurePopulation := GenerateFuturePopulation(fittestSurvivalReproductionRate, sortedPopulation)
-    MutateFuturePopulation(startingPopulation, futurePopulation, numSpecies)
+    futurePopulation := GenerateFuturePopulation(fittestSurvivalReproductionRate, sortedPopulation, rng)
+    MutateFuturePopulation(config, startingPopulation, futurePopulation, numSpecies, rng)
 
     startingPopulation = futurePopulation
+    state.population, state.generation = futurePopulation, i+1
+    if checkpointInterval > 0 && state.generation % checkpointInterval == 0 {
+      WriteCheckpoint(state, checkpointFile)
+    }
+
+    select {
+    case sig := <-interrupts:
+      fmt.Println("Received " + sig.String() + "; stopping the GA Algorithm after " + strconv.Itoa(state.generation) + " generations")
+      state.interruptedBy = sig
+      if checkpointInterval > 0 {
+        WriteCheckpoint(state, checkpointFile)
+      }
+      return bestSolution
+    default:
+    }
 
     if stabilityAcheived(maxLikelihoodScores, i, minStableGenerations) {
-      fmt.Println("No significant variation in likelihood scores over the last " + strconv.Itoa(minStableGenerations) + " generations")
+      fmt.Println("No significant variation in fitness scores over the last " + strconv.Itoa(minStableGenerations) + " generations")
       fmt.Println("Terminating the GA Algorithm\n")
       return bestSolution
     }
   }
 
+  // A run resumed from a checkpoint of its last generation has nothing left to do but to pick its best tree
+  if bestSolution == nil {
+    _, sortedPopulation := SortDescending(EvaluatePopulation(startingPopulation, alignment, scorer, numWorkers), startingPopulation)
+    bestSolution = sortedPopulation[0]
+  }
   return bestSolution
 }
 
+/*----------------------------------------------------------------------------------------------------
+ * Calculates the fitness scores of the whole population on a pool of goroutines. Every tree holds its
+ * own copy of the substitution model and the calculation draws no random numbers, so each score only
+ * depends on its tree and ends up at the same index no matter which worker computed it.
+ *---------------------------------------------------------------------------------------------------*/
+func EvaluatePopulation(population []*node, alignment *sitePatterns, scorer treeScorer, numWorkers int) []float64 {
+  fitnessScores := make([]float64, len(population))
+  solutionIndices := make(chan int, len(population))
+  for j:=0; j<len(population); j++ {
+    solutionIndices <- j
+  }
+  close(solutionIndices)
+
+  var workers sync.WaitGroup
+  for w:=0; w<numWorkers && w<len(population); w++ {
+    workers.Add(1)
+    go func() {
+      defer workers.Done()
+      for j := range solutionIndices {
+        fitnessScores[j] = scorer.Score(population[j], alignment)
+      }
+    }()
+  }
+  workers.Wait()
+  return fitnessScores
+}
+
 /*----------------------------------------------------------------------------------------------------
  * Since the dataset doesn't contain very large number of species, a very naive sorting algorithm is
  * implemented for sorting the likelihood scores and the population accordingly
@@ -104,7 +155,7 @@ func SortDescending(likelihoodScores []float64, startingPopulation []*node) ([]f
  * Given a sorted collection of trees according to their scores, we generate the next geenration of solutions
  * by selecting trees from the parent population with the appropriate probabilities
  *------------------------------------------------------------------------------------------------------*/
-func GenerateFuturePopulation(fittestSurvivalReproductionRate float64, sortedPopulation []*node) []*node {
+func GenerateFuturePopulation(fittestSurvivalReproductionRate float64, sortedPopulation []*node, rng *rand.Rand) []*node {
   futurePopulationCounter := 0
   numSolutions := len(sortedPopulation)
   futurePopulation := make([]*node, numSolutions)
@@ -115,7 +166,7 @@ func GenerateFuturePopulation(fittestSurvivalReproductionRate float64, sortedPop
   }
   for j:=1; j<numSolutions && futurePopulationCounter<numSolutions; j++ {
     survivalRate := float64(2)/float64((j+1)*(j+2))
-    if rand.Float64() < survivalRate {
+    if rng.Float64() < survivalRate {
       if futurePopulationCounter < numSolutions {
         futurePopulation[futurePopulationCounter] = GenerateTreeCopy(sortedPopulation[j])
         futurePopulationCounter++
@@ -141,12 +192,7 @@ func GenerateTreeCopy(root *node) *node {
   newRoot.name = root.name
   newRoot.leftChildDistance = root.leftChildDistance
   newRoot.rightChildDistance = root.rightChildDistance
-  for i:=0; i<5; i++ {
-    newRoot.nucleotideFrequencies[i] = root.nucleotideFrequencies[i]
-    for j:=0; j<5; j++ {
-      newRoot.conversionRatios[i][j] = root.conversionRatios[i][j]
-    }
-  }
+  newRoot.model = root.model.Copy()
   newRoot.leftChild = GenerateTreeCopy(root.leftChild)
   newRoot.rightChild = GenerateTreeCopy(root.rightChild)
   if newRoot.leftChild != nil {
@@ -0,0 +1,140 @@
+package main
+
+import (
+  "bytes"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "os"
+  "path/filepath"
+  "strconv"
+  "strings"
+)
+
+// A config file is read as JSON when it has the extension or its first character opens an object
+func IsJSONConfig(filename string) bool {
+  if strings.EqualFold(filepath.Ext(filename), ".json") {
+    return true
+  }
+  data, err := os.ReadFile(filename)
+  return err == nil && bytes.HasPrefix(bytes.TrimSpace(data), []byte("{"))
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * Reads a JSON config file into the configuration. The property names are the same as in config.txt, and
+ * can either be written out in full or split up into nested objects along their dots, ie.
+ *   { "ga.algo.params": { "population.count": 200, "model": "GTR" } }
+ * Comments starting with // run to the end of their line. The "presets" object holds named sets of
+ * properties in the same form, which are returned rather than applied.
+ *------------------------------------------------------------------------------------------------------*/
+func LoadJSONConfig(filename string, config *gaConfig) map[string]map[string]any {
+  data, err := os.ReadFile(filename)
+  if err != nil {
+    fmt.Println("Something went wrong while trying to read the input file:" + filename)
+    os.Exit(1)
+  }
+  data = StripJSONComments(data)
+
+  var document map[string]any
+  decoder := json.NewDecoder(bytes.NewReader(data))
+  decoder.UseNumber()
+  if err := decoder.Decode(&document); err != nil {
+    message := err.Error()
+    var syntaxError *json.SyntaxError
+    if errors.As(err, &syntaxError) {
+      message = "line " + strconv.Itoa(bytes.Count(data[:syntaxError.Offset], []byte("\n"))+1) + ": " + message
+    }
+    fmt.Println("Invalid JSON config file " + filename + ": " + message)
+    os.Exit(1)
+  }
+
+  problems := make([]string, 0)
+  presets := make(map[string]map[string]any)
+  if presetsValue, exists := document["presets"]; exists {
+    delete(document, "presets")
+    presetObjects, isObject := presetsValue.(map[string]any)
+    if !isObject {
+      problems = append(problems, "presets has to be an object of named presets")
+    }
+    for _, name := range SortedKeys(presetObjects) {
+      presetObject, isObject := presetObjects[name].(map[string]any)
+      if !isObject {
+        problems = append(problems, "preset " + name + " has to be an object of properties")
+        continue
+      }
+      presets[name] = make(map[string]any)
+      problems = FlattenJSONConfig("", presetObject, presets[name], problems)
+      // The properties of a preset are only checked for existence here; their values are checked once applied
+      for _, property := range SortedKeys(presets[name]) {
+        if _, exists := config.Property(property); !exists {
+          problems = append(problems, "preset " + name + ": " + UnknownPropertyMessage(config, property))
+        }
+      }
+    }
+  }
+
+  settings := make(map[string]any)
+  problems = FlattenJSONConfig("", document, settings, problems)
+  for _, name := range SortedKeys(settings) {
+    if err := ApplyConfigValue(config, name, settings[name]); err != nil {
+      problems = append(problems, err.Error())
+    }
+  }
+  if len(problems) > 0 {
+    ReportConfigProblems("The config file " + filename, problems)
+    os.Exit(1)
+  }
+  return presets
+}
+
+// Joins the keys of nested objects into dotted property names, reporting values that can not be a property
+func FlattenJSONConfig(prefix string, object map[string]any, settings map[string]any, problems []string) []string {
+  for _, key := range SortedKeys(object) {
+    name := key
+    if prefix != "" {
+      name = prefix + "." + key
+    }
+    switch val := object[key].(type) {
+    case map[string]any:
+      problems = FlattenJSONConfig(name, val, settings, problems)
+    case []any, nil:
+      problems = append(problems, name + " has to be a single number, bool or string")
+    default:
+      if _, exists := settings[name]; exists {
+        problems = append(problems, name + " is set more than once")
+      }
+      settings[name] = val
+    }
+  }
+  return problems
+}
+
+// Blanks out the // comments of the file, leaving strings and the line structure intact
+func StripJSONComments(data []byte) []byte {
+  stripped := make([]byte, 0, len(data))
+  inString, inComment := false, false
+  for i:=0; i<len(data); i++ {
+    c := data[i]
+    switch {
+    case inComment:
+      if c == '\n' {
+        inComment = false
+        stripped = append(stripped, c)
+      }
+    case inString:
+      stripped = append(stripped, c)
+      if c == '\\' && i+1 < len(data) {
+        i++
+        stripped = append(stripped, data[i])
+      } else if c == '"' {
+        inString = false
+      }
+    case c == '/' && i+1 < len(data) && data[i+1] == '/':
+      inComment = true
+    default:
+      inString = c == '"'
+      stripped = append(stripped, c)
+    }
+  }
+  return stripped
+}
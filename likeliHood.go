@@ -4,119 +4,250 @@ import (
   "fmt"
   "math"
   "os"
+  "strings"
+  "sync"
 )
 
+/*--------------------------------------------------------------------------------------------------------------------------
+ * The partial likelihoods of a subtree for every state of its root. To keep them from underflowing on large trees, they are
+ * divided by their largest value at every internal node, with the logarithm of all the factors removed so far kept alongside.
+ *------------------------------------------------------------------------------------------------------------------------*/
+type partialLikelihood struct {
+  scores [5]float64
+  logScale float64
+}
+
 /*--------------------------------------------------------------------------------------------------------------------------
  * Given a model phylogenic tree, the function calculates the probability that this model can explain the data that is observed
- * for a given sequence length. Although the problem consists of an exponential number of configuration for which probabilities
- * need to be calculated, there exists a dynamic programming solution that can solve it in polynomial time
- * Currently the slowest step in the algorithm; Needs to be improved.
+ * for the given site patterns. Although the problem consists of an exponential number of configuration for which probabilities
+ * need to be calculated, there exists a dynamic programming solution (Felsenstein's pruning algorithm) that can solve it in
+ * polynomial time. The substitution model of the tree is held by its root node; with among-site rate variation the likelihood of
+ * a site is averaged over the rate categories of the model. Every distinct site pattern is only evaluated once and weighed by
+ * the number of sites sharing it. The partial likelihoods are scaled on their way up the tree, so the score stays finite even
+ * for trees with hundreds of taxa. A long alignment can be spread over several goroutines, each handling a chunk of the patterns.
  *------------------------------------------------------------------------------------------------------------------------*/
-func CalculateMaxLikelihoodScores(solutionModel *node, speciesMap map[string]speciesGenome, sequenceLength int) float64 {
+func CalculateMaxLikelihoodScores(solutionModel *node, alignment *sitePatterns) float64 {
+  model := solutionModel.model
+  if model == nil {
+    fmt.Println("Invalid calculation of likelihood; the tree holds no substitution model!!")
+    os.Exit(1)
+  }
+  // The transition probabilities only depend on the branches and the rate category, so they are shared by all the sites
+  categoryRates, _ := model.SiteRateCategories()
+  transitionMaps := make([]map[*node]([2][5][5]float64), len(categoryRates))
+  for c:=0; c<len(categoryRates); c++ {
+    transitionMaps[c] = make(map[*node]([2][5][5]float64))
+    PrecomputeTransitionProbabilities(solutionModel, model, categoryRates[c], transitionMaps[c])
+  }
+
+  // The site patterns are split into chunks that are evaluated on separate goroutines. The transition probabilities have all
+  // been computed by now, so the chunks only ever read the shared maps, while each of them memoizes into its own scoreMaps.
+  numChunks := alignment.numChunks
+  numPatterns := len(alignment.patterns)
+  if numChunks > numPatterns {
+    numChunks = numPatterns
+  }
+  if numChunks <= 1 {
+    return CalculatePatternRangeLikelihood(solutionModel, model, transitionMaps, alignment, 0, numPatterns)
+  }
+  chunkSize := (numPatterns + numChunks - 1) / numChunks
+  chunkScores := make([]float64, numChunks)
+  var chunks sync.WaitGroup
+  for k:=0; k<numChunks; k++ {
+    start, end := k*chunkSize, (k+1)*chunkSize
+    if end > numPatterns {
+      end = numPatterns
+    }
+    chunks.Add(1)
+    go func(k, start, end int) {
+      defer chunks.Done()
+      chunkScores[k] = CalculatePatternRangeLikelihood(solutionModel, model, transitionMaps, alignment, start, end)
+    }(k, start, end)
+  }
+  chunks.Wait()
+
+  // The chunks are always added up in the same order, so the result does not depend on which of them finished first
   var logScore float64 = 0
-  for i:=0; i<sequenceLength; i++ {
-    var score float64 = 0
-    scoreMaps := make(map[*node]([5]float64))
-    var currScore, currScore1, currScore2 float64
-    var netScore float64
-    for j:=0; j<5; j++ {
-      currScore = solutionModel.nucleotideFrequencies[j]
-      for k:=0; k<5; k++ {
-        currScore1 = currScore*TransitionProbability(solutionModel, true, j, k)*
-                                  CalculateRecursiveLikelihood(solutionModel.leftChild, k, scoreMaps, speciesMap, i)
-        for l:=0; l<5; l++ {
-          currScore2 = currScore1*TransitionProbability(solutionModel, false, j, l)*
-                                  CalculateRecursiveLikelihood(solutionModel.rightChild, l, scoreMaps, speciesMap, i)
-          netScore += currScore2
-        }
+  for k:=0; k<numChunks; k++ {
+    logScore += chunkScores[k]
+  }
+  return logScore
+}
+
+/*-------------------------------------------------------------------------------------------------------------------------
+ * The sum of the weighted log likelihoods of the site patterns in [start, end)
+ *-----------------------------------------------------------------------------------------------------------------------*/
+func CalculatePatternRangeLikelihood(solutionModel *node, model *substitutionModel, transitionMaps []map[*node]([2][5][5]float64),
+                                     alignment *sitePatterns, start, end int) float64 {
+  categoryRates, categoryWeights := model.SiteRateCategories()
+  var logScore float64 = 0
+  categoryLogScores := make([]float64, len(categoryRates))
+  for i:=start; i<end; i++ {
+    for c:=0; c<len(categoryRates); c++ {
+      scoreMaps := make(map[*node]partialLikelihood)
+      rootScores := CalculateRecursiveLikelihood(solutionModel, model, categoryRates[c], scoreMaps, transitionMaps[c], alignment, i)
+      var categoryScore float64 = 0
+      for j:=0; j<model.numStates; j++ {
+        categoryScore += model.frequencies[j]*rootScores.scores[j]
       }
-      score += netScore
+      categoryLogScores[c] = math.Log(categoryWeights[c]*categoryScore) + rootScores.logScale
     }
-    logScore +=   math.Log(score)
+    logScore += alignment.weights[i]*LogSumExp(categoryLogScores)
   }
   return logScore
 }
 
 /*-------------------------------------------------------------------------------------------------------------------------
- * For a particular species, calculates its probability of making a change in nucleotide sequence from one base to another
+ * Adds up numbers given by their logarithms without leaving the log space, ie. log(exp(a) + exp(b) + ...). The categories of
+ * a site can have been scaled by very different factors, which rules out adding them up directly.
  *-----------------------------------------------------------------------------------------------------------------------*/
-func TransitionProbability(currNode *node, direction bool, nct1, nct2 int) float64 {
-  var probability float64
-  var branchLength float64
+func LogSumExp(logValues []float64) float64 {
+  maxValue := math.Inf(-1)
+  for _, val := range logValues {
+    maxValue = math.Max(maxValue, val)
+  }
+  if math.IsInf(maxValue, 0) {
+    return maxValue
+  }
+  var sum float64
+  for _, val := range logValues {
+    sum += math.Exp(val - maxValue)
+  }
+  return maxValue + math.Log(sum)
+}
 
-  if direction {
-    branchLength = currNode.leftChildDistance
-  } else {
-    branchLength = currNode.rightChildDistance
+/*-------------------------------------------------------------------------------------------------------------------------
+ * For the branches leading to both children of a node, calculates the probabilities of a change in nucleotide from one base
+ * to another as given by the substitution model over the length of the branch, scaled by the rate of the site category
+ *-----------------------------------------------------------------------------------------------------------------------*/
+func TransitionProbability(currNode *node, model *substitutionModel, rate float64, transitionMaps map[*node]([2][5][5]float64)) [2][5][5]float64 {
+  probabilities, exists := transitionMaps[currNode]
+  if !exists {
+    probabilities[0] = model.TransitionMatrix(currNode.leftChildDistance*rate)
+    probabilities[1] = model.TransitionMatrix(currNode.rightChildDistance*rate)
+    transitionMaps[currNode] = probabilities
   }
+  return probabilities
+}
 
-  if nct1 == nct2 {
-    probability = (1.0-branchLength)
-  } else {
-    probability = branchLength
+// Fills in the transition probabilities of every branch of the tree ahead of the likelihood calculations
+func PrecomputeTransitionProbabilities(currNode *node, model *substitutionModel, rate float64, transitionMaps map[*node]([2][5][5]float64)) {
+  if currNode == nil || (currNode.leftChild == nil && currNode.rightChild == nil) {
+    return
   }
-  probability *= currNode.conversionRatios[nct1][nct2]
-  return probability
+  TransitionProbability(currNode, model, rate, transitionMaps)
+  PrecomputeTransitionProbabilities(currNode.leftChild, model, rate, transitionMaps)
+  PrecomputeTransitionProbabilities(currNode.rightChild, model, rate, transitionMaps)
 }
 
 /*---------------------------------------------------------------------------------------------------------------------------
- * The meoized recursive solution for estimating the maxlikelihood score, similar to it's parent function with the exception of
- * holding the solution for the base case.
+ * The meoized recursive solution for estimating the maxlikelihood score, returning the scaled partial likelihoods of the subtree
+ * for every possible state of its root. Ambiguous bases at the leaves allow every state they stand for.
  *--------------------------------------------------------------------------------------------------------------------------*/
-func CalculateRecursiveLikelihood(currNode *node, nct int, scoreMaps map[*node]([5]float64), speciesMap map[string]speciesGenome, index int) float64 {
+func CalculateRecursiveLikelihood(currNode *node, model *substitutionModel, rate float64, scoreMaps map[*node]partialLikelihood,
+                                  transitionMaps map[*node]([2][5][5]float64), alignment *sitePatterns, index int) partialLikelihood {
   if currNode == nil {
     fmt.Println("Invalid calculation of likelihood; null node detected!! ")
     os.Exit(1)
   }
   val, exists := scoreMaps[currNode]
   if exists {
-    return val[nct]
+    return val
   }
+  var nctScores partialLikelihood
   if currNode.leftChild == nil && currNode.rightChild == nil {
-    species, exists := speciesMap[currNode.name]
+    currNct, exists := alignment.Nucleotide(currNode.name, index)
     if !exists {
       fmt.Println("Invalid Tree or Map present")
       os.Exit(1)
     }
-    currNct := species.nucleotideSequence[index]
-    var nctScores [5]float64
-    if currNct == 'A' || currNct == 'a' {
-      nctScores[0] = currNode.nucleotideFrequencies[0]
-    } else if currNct == 'C' || currNct == 'c' {
-      nctScores[1] = currNode.nucleotideFrequencies[1]
-    } else if currNct == 'G' || currNct == 'g' {
-      nctScores[2] = currNode.nucleotideFrequencies[2]
-    } else if currNct == 'T' || currNct == 't' {
-      nctScores[3] = currNode.nucleotideFrequencies[3]
-    } else if currNct == '-' || currNct == '.' {
-      nctScores[4] = currNode.nucleotideFrequencies[4]
-    } else {
+    allowedStates, valid := NucleotideStateSet(currNct, model.numStates == 4)
+    if !valid {
       fmt.Println("Invalid nucleotide base detected in input !!")
       os.Exit(1)
     }
+    for i:=0; i<model.numStates; i++ {
+      if allowedStates[i] {
+        nctScores.scores[i] = 1
+      }
+    }
 
     scoreMaps[currNode] = nctScores
-    return nctScores[nct]
-  }
-
-  var nctScores [5]float64
-  var currScore, currScore1, currScore2 float64
-  var netScore float64
-  for i:=0; i<5; i++ {
-    currScore = currNode.nucleotideFrequencies[i]
-    for j:=0; j<5; j++ {
-      currScore1 = currScore*TransitionProbability(currNode, true, i, j)*
-                                CalculateRecursiveLikelihood(currNode.leftChild, j, scoreMaps, speciesMap, index)
-      for k:=0; k<5; k++ {
-        currScore2 = currScore1*TransitionProbability(currNode, false, i, k)*
-                                CalculateRecursiveLikelihood(currNode.rightChild, k, scoreMaps, speciesMap, index)
-        netScore += currScore2
-      }
+    return nctScores
+  }
+
+  leftScores := CalculateRecursiveLikelihood(currNode.leftChild, model, rate, scoreMaps, transitionMaps, alignment, index)
+  rightScores := CalculateRecursiveLikelihood(currNode.rightChild, model, rate, scoreMaps, transitionMaps, alignment, index)
+  probabilities := TransitionProbability(currNode, model, rate, transitionMaps)
+  var maxScore float64
+  for i:=0; i<model.numStates; i++ {
+    var leftScore, rightScore float64
+    for j:=0; j<model.numStates; j++ {
+      leftScore += probabilities[0][i][j]*leftScores.scores[j]
+      rightScore += probabilities[1][i][j]*rightScores.scores[j]
+    }
+    nctScores.scores[i] = leftScore*rightScore
+    maxScore = math.Max(maxScore, nctScores.scores[i])
+  }
+  nctScores.logScale = leftScores.logScale + rightScores.logScale
+  if maxScore > 0 {
+    for i:=0; i<model.numStates; i++ {
+      nctScores.scores[i] /= maxScore
     }
-    nctScores[i] = netScore
+    nctScores.logScale += math.Log(maxScore)
   }
 
   scoreMaps[currNode] = nctScores
-  return nctScores[nct]
+  return nctScores
+}
+
+/*---------------------------------------------------------------------------------------------------------------------------
+ * The set of states (A, C, G, T and the gap) that a character of the input sequences stands for. Besides the plain bases the
+ * IUPAC ambiguity codes are understood, with N and X allowing any base and '?' allowing any state at all. Gaps are either
+ * a state of their own, or when treated as missing data, allow every state just like '?'.
+ *--------------------------------------------------------------------------------------------------------------------------*/
+func NucleotideStateSet(nct byte, gapsAsMissing bool) ([5]bool, bool) {
+  var states [5]bool
+  var codes string
+  switch nct {
+  case 'A', 'a': codes = "A"
+  case 'C', 'c': codes = "C"
+  case 'G', 'g': codes = "G"
+  case 'T', 't', 'U', 'u': codes = "T"
+  case 'R', 'r': codes = "AG"
+  case 'Y', 'y': codes = "CT"
+  case 'S', 's': codes = "CG"
+  case 'W', 'w': codes = "AT"
+  case 'K', 'k': codes = "GT"
+  case 'M', 'm': codes = "AC"
+  case 'B', 'b': codes = "CGT"
+  case 'D', 'd': codes = "AGT"
+  case 'H', 'h': codes = "ACT"
+  case 'V', 'v': codes = "ACG"
+  case 'N', 'n', 'X', 'x': codes = "ACGT"
+  case '?': codes = "ACGT-"
+  case '-', '.':
+    if gapsAsMissing {
+      codes = "ACGT-"
+    } else {
+      codes = "-"
+    }
+  default:
+    return states, false
+  }
+  for i:=0; i<len(codes); i++ {
+    states[strings.IndexByte("ACGT-", codes[i])] = true
+  }
+  return states, true
+}
+
+// The characters of the input sequences that can be handled at the leaves of the tree
+func IsValidNucleotide(nct byte) bool {
+  _, valid := NucleotideStateSet(nct, false)
+  return valid
+}
 
+// Characters carrying no information on the base at a site; used for detecting sequences made up of gaps only
+func IsGapOrMissing(nct byte) bool {
+  return nct == '-' || nct == '.' || nct == '?'
 }
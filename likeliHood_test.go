@@ -0,0 +1,146 @@
+package main
+
+import (
+  "math"
+  "math/rand/v2"
+  "strconv"
+  "testing"
+)
+
+// A caterpillar tree over the taxa, ie. every internal node has a leaf as its left child, with the same length on every branch
+func CaterpillarTree(speciesList []speciesGenome, branchLength float64) *node {
+  last := len(speciesList) - 1
+  root := &node{name:speciesList[last].name}
+  for i:=last-1; i>=0; i-- {
+    leaf := &node{name:speciesList[i].name}
+    ancestor := &node{leftChild:leaf, rightChild:root, leftChildDistance:branchLength, rightChildDistance:branchLength}
+    leaf.parent, root.parent = ancestor, ancestor
+    root = ancestor
+  }
+  return root
+}
+
+// A tree of random shape over the taxa, joining random pairs of subtrees by branches of random length
+func RandomBinaryTree(speciesList []speciesGenome, rng *rand.Rand) *node {
+  subtrees := make([]*node, len(speciesList))
+  for i, species := range speciesList {
+    subtrees[i] = &node{name:species.name}
+  }
+  for len(subtrees) > 1 {
+    i := rng.IntN(len(subtrees))
+    left := subtrees[i]
+    subtrees = append(subtrees[:i], subtrees[i+1:]...)
+    j := rng.IntN(len(subtrees))
+    ancestor := &node{leftChild:left, rightChild:subtrees[j], leftChildDistance:rng.Float64()/5, rightChildDistance:rng.Float64()/5}
+    left.parent, subtrees[j].parent = ancestor, ancestor
+    subtrees[j] = ancestor
+  }
+  return subtrees[0]
+}
+
+// Random sequences over the given characters, one for each of the taxa
+func RandomSpeciesList(numTaxa, numSites int, characters string, rng *rand.Rand) []speciesGenome {
+  speciesList := make([]speciesGenome, numTaxa)
+  for i := range speciesList {
+    sequence := make([]byte, numSites)
+    for k := range sequence {
+      sequence[k] = characters[rng.IntN(len(characters))]
+    }
+    speciesList[i] = speciesGenome{name:"taxon" + strconv.Itoa(i), nucleotideSequence:string(sequence)}
+  }
+  return speciesList
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * The log likelihood of the tree by the plain pruning algorithm, site by site and without any scaling of
+ * the partial likelihoods, to check the scaled and compressed calculation against
+ *------------------------------------------------------------------------------------------------------*/
+func UnscaledLikelihood(root *node, speciesList []speciesGenome) float64 {
+  model := root.model
+  sequences := make(map[string]string)
+  for _, species := range speciesList {
+    sequences[species.name] = species.nucleotideSequence
+  }
+  var partials func(currNode *node, rate float64, site int) [5]float64
+  partials = func(currNode *node, rate float64, site int) [5]float64 {
+    var scores [5]float64
+    if currNode.leftChild == nil && currNode.rightChild == nil {
+      allowedStates, _ := NucleotideStateSet(sequences[currNode.name][site], model.numStates == 4)
+      for i:=0; i<model.numStates; i++ {
+        if allowedStates[i] {
+          scores[i] = 1
+        }
+      }
+      return scores
+    }
+    leftScores, rightScores := partials(currNode.leftChild, rate, site), partials(currNode.rightChild, rate, site)
+    leftProbabilities := model.TransitionMatrix(currNode.leftChildDistance*rate)
+    rightProbabilities := model.TransitionMatrix(currNode.rightChildDistance*rate)
+    for i:=0; i<model.numStates; i++ {
+      var leftScore, rightScore float64
+      for j:=0; j<model.numStates; j++ {
+        leftScore += leftProbabilities[i][j]*leftScores[j]
+        rightScore += rightProbabilities[i][j]*rightScores[j]
+      }
+      scores[i] = leftScore*rightScore
+    }
+    return scores
+  }
+
+  categoryRates, categoryWeights := model.SiteRateCategories()
+  var logScore float64
+  for site:=0; site<len(speciesList[0].nucleotideSequence); site++ {
+    var siteScore float64
+    for c := range categoryRates {
+      rootScores := partials(root, categoryRates[c], site)
+      for i:=0; i<model.numStates; i++ {
+        siteScore += categoryWeights[c]*model.frequencies[i]*rootScores[i]
+      }
+    }
+    logScore += math.Log(siteScore)
+  }
+  return logScore
+}
+
+func TestLikelihoodMatchesUnscaledCalculation(t *testing.T) {
+  rng := rand.New(rand.NewPCG(7, 7))
+  speciesList := RandomSpeciesList(8, 60, "AACGTTG-RN", rng)
+  for _, gapsAsState := range []bool{false, true} {
+    root := RandomBinaryTree(speciesList, rng)
+    root.model = NewSubstitutionModel("HKY85", gapsAsState)
+    root.model.frequencies = [5]float64{0.3, 0.2, 0.15, 0.3, 0.05}
+    root.model.SetRateHeterogeneity(4, 0.5, 0.1)
+    root.model.Constrain()
+    alignment := CompressSitePatterns(speciesList, 0)
+
+    expected := UnscaledLikelihood(root, speciesList)
+    for _, numChunks := range []int{1, 3} {
+      alignment.numChunks = numChunks
+      score := CalculateMaxLikelihoodScores(root, alignment)
+      if math.Abs(score - expected) > 1e-9*math.Abs(expected) {
+        t.Errorf("gaps as a state %t, %d chunks: log likelihood %v, expected %v", gapsAsState, numChunks, score, expected)
+      }
+    }
+  }
+}
+
+func TestLikelihoodOfLargeTreeIsFinite(t *testing.T) {
+  rng := rand.New(rand.NewPCG(11, 11))
+  speciesList := RandomSpeciesList(600, 40, "ACGT", rng)
+  root := CaterpillarTree(speciesList, 2.0)
+  root.model = NewSubstitutionModel("GTR", false)
+  alignment := CompressSitePatterns(speciesList, 0)
+
+  // Every site is about 4^-600 likely, far below the smallest float64, so the plain calculation underflows
+  if unscaled := UnscaledLikelihood(root, speciesList); !math.IsInf(unscaled, -1) {
+    t.Fatalf("the unscaled log likelihood was expected to underflow, got %v", unscaled)
+  }
+  score := CalculateMaxLikelihoodScores(root, alignment)
+  if math.IsInf(score, 0) || math.IsNaN(score) {
+    t.Fatalf("the log likelihood of a caterpillar of %d taxa is %v", len(speciesList), score)
+  }
+  // With branches this long the leaves are nearly independent of each other
+  if expected := float64(40*600)*math.Log(0.25); math.Abs(score - expected) > 0.01*math.Abs(expected) {
+    t.Errorf("log likelihood %v, expected about %v", score, expected)
+  }
+}
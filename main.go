@@ -1,34 +1,25 @@
 package main
 
 import (
+  "flag"
   "fmt"
   "os"
-  //"time"
-  "math/rand"
+  "os/signal"
+  "strconv"
+  "syscall"
+  "time"
+  "math/rand/v2"
 )
 
-// The basic object that is used to represent a species in the phyolgenetic tree model
+// The basic object that is used to represent a species in the phyolgenetic tree model. The substitution model
+// is shared by the whole tree and only held by its root node.
 type node struct {
   name string
-  conversionRatios [5][5]float64
-  nucleotideFrequencies [5]float64
+  model *substitutionModel
   leftChild, rightChild, parent *node
   leftChildDistance, rightChildDistance float64
 }
 
-// Initialization of the nucleotide conversion ratios and frequencies
-func (n *node) Initialize() {
-    n.conversionRatios = [5][5]float64{
-      //A    C      G     T     Deletion
-      {0.94, 0.02, 0.01, 0.02, 0.01}, // A
-      {0.02, 0.94, 0.02, 0.01, 0.01}, // C
-      {0.01, 0.02, 0.94, 0.02, 0.01}, // G
-      {0.02, 0.01, 0.02, 0.94, 0.01}, // T
-      {0.01, 0.01, 0.01, 0.01, 0.96}, // Insertion
-      }
-    n.nucleotideFrequencies = [5]float64 {0.24, 0.24, 0.24, 0.24, 0.04}
-}
-
 // A basic reperesentation for the aligned sequences of the given species
 type speciesGenome struct {
   name string
@@ -37,73 +28,199 @@ type speciesGenome struct {
 
 func main() {
 
-  if len(os.Args) != 2 {
+  // Besides running the GA, the program offers a few commands of its own, picked by the first argument
+  if len(os.Args) > 1 {
+    switch os.Args[1] {
+    case "score":
+      RunScoreCommand(os.Args[2:])
+      return
+    case "nj":
+      RunNJCommand(os.Args[2:])
+      return
+    case "upgma":
+      RunUPGMACommand(os.Args[2:])
+      return
+    case "distances":
+      RunDistancesCommand(os.Args[2:])
+      return
+    }
+  }
+
+  seedFlag := flag.Int64("seed", 0, "seed for the random number generator; overrides ga.random.seed")
+  resumeFlag := flag.String("resume", "", "checkpoint file of an earlier run to continue from")
+  configFlag := flag.String("config", "config.txt", "the config file holding the parameters of the run; either JSON or the config.txt format")
+  presetFlag := flag.String("preset", "", "a named set of parameters applied over the config file, ie. quick, thorough or large-dataset")
+  var overrides configOverrides
+  flag.Var(&overrides, "set", "property=value overriding a property of the config file; can be repeated")
+  flag.Parse()
+  if flag.NArg() != 1 {
     fmt.Println("Please enter the dataset filepath for starting the program")
     os.Exit(1)
   }
-  filename := os.Args[1]
-  speciesList, speciesMap  := LoadDatasets(filename)
-  fmt.Println("The required nucleotide sequences of species has been successfully obtained!!")
 
-  numSolutions := LoadIntConfig("ga.algo.params.population.count")
-  numGenerations := LoadIntConfig("ga.algo.params.generations.count")
-  minStableGenerations := LoadIntConfig("ga.algo.params.generations.stable.limit")
+  // The settings of the command line take precedence over the ones of the config file
+  config := LoadValidatedConfig(*configFlag, *presetFlag, overrides)
 
-  initialPopulation := GenerateRandomSolutions(speciesList, numSolutions)
-  fmt.Println("Successfully generated a set of random Phylogenetic Trees for the Genetic Algorithm")
+  filename := flag.Arg(0)
+  speciesList, _ := LoadDatasets(filename)
+  fmt.Println("The required nucleotide sequences of species has been successfully obtained!!")
+  referenceTrees := LoadReferenceTrees(filename)
+  if len(referenceTrees) > 0 {
+    fmt.Println("Found " + strconv.Itoa(len(referenceTrees)) + " reference trees in the TREES block of the input file")
+  }
+
+  // The alignment is collapsed into its distinct site patterns once, as only those matter for the likelihood
+  alignment := CompressSitePatterns(speciesList, config.sequenceLengthMax)
+  alignment.numChunks = config.siteThreads
+  fmt.Println("Compressed " + strconv.Itoa(alignment.numSites) + " sites into " + strconv.Itoa(len(alignment.patterns)) + " distinct site patterns")
+
+  // All the randomness of the run flows from a single generator, so a run can be reproduced from its seed. A resumed
+  // run picks up the generator exactly in the state it was saved in.
+  var state *gaState
+  if *resumeFlag != "" {
+    state = LoadCheckpoint(*resumeFlag, config.generationsCount)
+  } else {
+    seed := uint64(config.randomSeed)
+    if *seedFlag != 0 {
+      seed = uint64(*seedFlag)
+    }
+    if seed == 0 {
+      seed = uint64(time.Now().UTC().UnixNano())
+    }
+    fmt.Println("Using the random seed " + strconv.FormatUint(seed, 10))
+    rngSource := rand.NewPCG(seed, seed)
 
-  bestPhylogenyModel := RunGASimulations(initialPopulation, speciesMap, numGenerations, minStableGenerations)
+    initialPopulation := GenerateRandomSolutions(speciesList, config, rand.New(rngSource))
+    fmt.Println("Successfully generated a set of random Phylogenetic Trees for the Genetic Algorithm")
+    state = &gaState{population:initialPopulation, maxLikelihoodScores:make([]float64, config.generationsCount), rngSource:rngSource}
+  }
+  fmt.Println("Using the " + state.population[0].model.Description() + " substitution model")
+
+  // Interrupting the program only stops the GA after the current generation, so that the best tree is not lost. A
+  // second interrupt ends the program right away, for when the generation takes longer than the user cares to wait.
+  signals := make(chan os.Signal, 1)
+  interrupts := make(chan os.Signal, 1)
+  signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+  go func() {
+    interrupts <- <-signals
+    fmt.Println("Finishing the current generation before stopping; interrupt again to stop right away")
+    sig := <-signals
+    fmt.Println("Received " + sig.String() + " again; stopping right away")
+    os.Exit(InterruptedExitCode(sig))
+  }()
+  startTime := time.Now()
+
+  bestPhylogenyModel := RunGASimulations(config, state, alignment, rand.New(state.rngSource), interrupts)
+  signal.Stop(signals)
   fmt.Println(NewickFormatTreeRepresentation(bestPhylogenyModel))
+  WriteRunSummary(config, bestPhylogenyModel, alignment, state, time.Since(startTime))
+
+  if state.interruptedBy != nil {
+    os.Exit(InterruptedExitCode(state.interruptedBy))
+  }
+}
+
+/*----------------------------------------------------------------------------------------------------------------
+ * Prints the outcome of the run and writes it to the summary file: the best tree along with its score, the number
+ * of generations that were completed and the reason the run ended.
+ *----------------------------------------------------------------------------------------------------------------*/
+func WriteRunSummary(config *gaConfig, bestSolution *node, alignment *sitePatterns, state *gaState, elapsed time.Duration) {
+  filename := config.summaryFile
+  termination := "completed"
+  if state.interruptedBy != nil {
+    termination = "interrupted by " + state.interruptedBy.String()
+  }
+  scorer, err := NewTreeScorer(config, alignment)
+  if err != nil {
+    fmt.Println(err)
+    os.Exit(1)
+  }
+  summary := "Best tree: " + NewickFormatTreeRepresentation(bestSolution) + "\n" +
+             scorer.Describe(scorer.Score(bestSolution, alignment)) + "\n"
+  // The model of a tree found by any other criterion has not been fitted, so it would mean little
+  if config.fitnessCriterion == "likelihood" {
+    summary += "Substitution model: " + bestSolution.model.Description() + "\n"
+  }
+  summary += "Generations: " + strconv.Itoa(state.generation) + "\n" +
+             "Population size: " + strconv.Itoa(len(state.population)) + "\n" +
+             "Running time: " + elapsed.Round(time.Second).String() + "\n" +
+             "Run " + termination + "\n"
+  fmt.Print("\n" + summary)
+  if filename == "" {
+    return
+  }
+  if err := os.WriteFile(filename, []byte(summary), 0644); err != nil {
+    fmt.Println("Something went wrong while trying to write the summary file:" + filename)
+    return
+  }
+  fmt.Println("The run summary has been written to " + filename)
+}
+
+// The conventional exit code of a program stopped by a signal, ie. 130 for SIGINT and 143 for SIGTERM
+func InterruptedExitCode(sig os.Signal) int {
+  if sysSignal, ok := sig.(syscall.Signal); ok {
+    return 128 + int(sysSignal)
+  }
+  return 128
+}
+
+/*----------------------------------------------------------------------------------------------------------------
+ * Generates the initial population of the GA. The seeded share of it, made up of the trees of the user and those of
+ * the distance methods, comes first; the remainder consists of random trees. Every tree gets its own copy of the
+ * substitution model.
+ *----------------------------------------------------------------------------------------------------------------*/
+func GenerateRandomSolutions(speciesList []speciesGenome, config *gaConfig, rng *rand.Rand) []*node {
+  population := GenerateSeedSolutions(speciesList, config, rng)
+  for len(population) < config.populationCount {
+    population = append(population, GenerateRandomTree(speciesList, rng))
+  }
+  for i := range population {
+    population[i].model = NewSubstitutionModel(config.modelName, !config.gapsAsMissing)
+    population[i].model.SetRateHeterogeneity(config.gammaCategories, config.gammaAlpha, config.invariantProportion)
+  }
+  return population
 }
 
 /*----------------------------------------------------------------------------------------------------------------
  * Function for randomly generataing tree topologies and branchlengths. Works by recursively joining any two nodes
  * that do not have a parent together until there is only one such node present which becomes the root of the graph.
  *----------------------------------------------------------------------------------------------------------------*/
-func GenerateRandomSolutions(speciesList []speciesGenome, numSolutions int) []*node {
+func GenerateRandomTree(speciesList []speciesGenome, rng *rand.Rand) *node {
   numSpecies := len(speciesList)
-  population := make([]*node, numSolutions)
-
-  for i:=0; i<numSolutions; i++ {
 
-    treeConstructionBase := make([]*node, numSpecies)
-    for j:=0; j<numSpecies; j++ {
-      var leaf node
-      leaf.Initialize()
-      leaf.name = speciesList[j].name
-      treeConstructionBase[j] = &leaf
-    }
-
-    for len(treeConstructionBase) != 1 {
-      var ancestralNode node
-      ancestralNode.Initialize()
-      ancestralNode.leftChild, treeConstructionBase = GetAndRemoveRandomNodePointer(treeConstructionBase)
-      ancestralNode.leftChildDistance = (rand.Float64()/10)
-      ancestralNode.leftChild.parent = &ancestralNode
-      ancestralNode.rightChild, treeConstructionBase = GetAndRemoveRandomNodePointer(treeConstructionBase)
-      ancestralNode.rightChildDistance = (rand.Float64()/10)
-      ancestralNode.rightChild.parent = &ancestralNode
-      ancestralNode.name = "Ancestor"
-
-      treeConstructionBase = append(treeConstructionBase, &ancestralNode)
-    }
+  treeConstructionBase := make([]*node, numSpecies)
+  for j:=0; j<numSpecies; j++ {
+    var leaf node
+    leaf.name = speciesList[j].name
+    treeConstructionBase[j] = &leaf
+  }
 
-    population[i] = treeConstructionBase[0]
+  for len(treeConstructionBase) != 1 {
+    var ancestralNode node
+    ancestralNode.leftChild, treeConstructionBase = GetAndRemoveRandomNodePointer(treeConstructionBase, rng)
+    ancestralNode.leftChildDistance = (rng.Float64()/10)
+    ancestralNode.leftChild.parent = &ancestralNode
+    ancestralNode.rightChild, treeConstructionBase = GetAndRemoveRandomNodePointer(treeConstructionBase, rng)
+    ancestralNode.rightChildDistance = (rng.Float64()/10)
+    ancestralNode.rightChild.parent = &ancestralNode
+    ancestralNode.name = "Ancestor"
+
+    treeConstructionBase = append(treeConstructionBase, &ancestralNode)
   }
 
-  return population
+  return treeConstructionBase[0]
 }
 
 /*-----------------------------------------------------------------------------------------------------------
  * Helper method for the above fucntion; performs the process of choosing a random node and maitaing the list
  * of parentless nodes at any point of time while the tree is being built
  *------------------------------------------------------------------------------------------------------------*/
-func GetAndRemoveRandomNodePointer(treeConstructionBase []*node) (*node, []*node) {
+func GetAndRemoveRandomNodePointer(treeConstructionBase []*node, rng *rand.Rand) (*node, []*node) {
   if len(treeConstructionBase) < 1 {
     fmt.Println("Invalid tree construction procedure, please double-check!!")
     os.Exit(1)
   }
-  randNodeIndex := rand.Intn(len(treeConstructionBase))
+  randNodeIndex := rng.IntN(len(treeConstructionBase))
   retNodePointer := treeConstructionBase[randNodeIndex]
   treeConstructionBase = append(treeConstructionBase[:randNodeIndex], treeConstructionBase[randNodeIndex+1:]...)
   return retNodePointer, treeConstructionBase
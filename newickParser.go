@@ -0,0 +1,267 @@
+package main
+
+import (
+  "errors"
+  "fmt"
+  "math/rand/v2"
+  "os"
+  "strconv"
+  "strings"
+)
+
+// A node of a Newick tree as it is written, with any number of children
+type newickNode struct {
+  name string
+  branchLength float64
+  children []*newickNode
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * Reads a tree in the Newick format into the node structure of the program. Besides the trees written by
+ * NewickFormatTreeRepresentation, this handles internal node labels, quoted names ('' standing for a
+ * single quote), [comments] and nodes with any number of children. As the program only works with binary
+ * trees, a node with more than two children is resolved into random binary splits joined by branches of
+ * length zero when a random number generator is given, and rejected otherwise. Nodes with a single child
+ * are merged into it. Names are taken as they are; underscores are not turned into spaces.
+ *------------------------------------------------------------------------------------------------------*/
+func ParseNewickTree(newick string, rng *rand.Rand) *node {
+  parsedTree, err := ParseNewick(newick)
+  if err == nil {
+    var root *node
+    root, err = BuildBinaryTree(parsedTree, rng)
+    if err == nil {
+      return root
+    }
+  }
+  fmt.Println("Invalid Newick tree " + strings.TrimSpace(newick) + ": " + err.Error())
+  os.Exit(1)
+  return nil
+}
+
+// Reads a Newick tree as it is written, ie. without forcing it to be binary
+func ParseNewick(newick string) (*newickNode, error) {
+  parser := newickParser{text:newick}
+  root, err := parser.parseSubtree()
+  if err != nil {
+    return nil, err
+  }
+  parser.skipSpaceAndComments()
+  if parser.position >= len(newick) || newick[parser.position] != ';' {
+    return nil, parser.errorf("expected ';' at the end of the tree")
+  }
+  parser.position++
+  parser.skipSpaceAndComments()
+  if parser.position < len(newick) {
+    return nil, parser.errorf("unexpected characters after the end of the tree")
+  }
+  return root, nil
+}
+
+type newickParser struct {
+  text string
+  position int
+}
+
+func (parser *newickParser) errorf(format string, args ...any) error {
+  return errors.New(fmt.Sprintf(format, args...) + " (at position " + strconv.Itoa(parser.position+1) + ")")
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * Parses the subtree starting at the current position: an optional list of children in brackets, followed
+ * by an optional name and an optional ':length'
+ *------------------------------------------------------------------------------------------------------*/
+func (parser *newickParser) parseSubtree() (*newickNode, error) {
+  currNode := &newickNode{}
+  parser.skipSpaceAndComments()
+  if parser.position < len(parser.text) && parser.text[parser.position] == '(' {
+    for {
+      parser.position++
+      child, err := parser.parseSubtree()
+      if err != nil {
+        return nil, err
+      }
+      currNode.children = append(currNode.children, child)
+      parser.skipSpaceAndComments()
+      if parser.position >= len(parser.text) {
+        return nil, parser.errorf("missing ')'")
+      }
+      if parser.text[parser.position] == ')' {
+        parser.position++
+        break
+      }
+      if parser.text[parser.position] != ',' {
+        return nil, parser.errorf("expected ',' or ')' but found '%c'", parser.text[parser.position])
+      }
+    }
+  }
+
+  name, err := parser.parseName()
+  if err != nil {
+    return nil, err
+  }
+  currNode.name = name
+  if len(currNode.children) == 0 && name == "" {
+    return nil, parser.errorf("missing species name")
+  }
+
+  parser.skipSpaceAndComments()
+  if parser.position < len(parser.text) && parser.text[parser.position] == ':' {
+    parser.position++
+    parser.skipSpaceAndComments()
+    start := parser.position
+    for parser.position < len(parser.text) && strings.IndexByte("()[],:; \t\n\r", parser.text[parser.position]) < 0 {
+      parser.position++
+    }
+    currNode.branchLength, err = strconv.ParseFloat(parser.text[start:parser.position], 64)
+    if err != nil {
+      parser.position = start
+      return nil, parser.errorf("bad branch length")
+    }
+  }
+  return currNode, nil
+}
+
+// Reads a quoted or an unquoted name, which may be empty
+func (parser *newickParser) parseName() (string, error) {
+  parser.skipSpaceAndComments()
+  text := parser.text
+  if parser.position < len(text) && text[parser.position] == '\'' {
+    var name strings.Builder
+    for parser.position++; parser.position < len(text); parser.position++ {
+      if text[parser.position] == '\'' {
+        if parser.position+1 < len(text) && text[parser.position+1] == '\'' {
+          name.WriteByte('\'')
+          parser.position++
+          continue
+        }
+        parser.position++
+        return name.String(), nil
+      }
+      name.WriteByte(text[parser.position])
+    }
+    return "", parser.errorf("unterminated quoted name")
+  }
+  start := parser.position
+  for parser.position < len(text) && strings.IndexByte("()[],:;' \t\n\r", text[parser.position]) < 0 {
+    parser.position++
+  }
+  return text[start:parser.position], nil
+}
+
+// Moves past whitespace and comments, which may be nested
+func (parser *newickParser) skipSpaceAndComments() {
+  depth := 0
+  for parser.position < len(parser.text) {
+    switch c := parser.text[parser.position]; {
+    case c == '[':
+      depth++
+    case c == ']' && depth > 0:
+      depth--
+    case depth == 0 && c != ' ' && c != '\t' && c != '\n' && c != '\r':
+      return
+    }
+    parser.position++
+  }
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * Converts a parsed Newick tree into the binary node structure. Internal nodes keep their label as their
+ * name, or are named "Ancestor" when they have none.
+ *------------------------------------------------------------------------------------------------------*/
+func BuildBinaryTree(parsedTree *newickNode, rng *rand.Rand) (*node, error) {
+  parsedTree = MergeSingleChildren(parsedTree)
+  currNode := &node{name:parsedTree.name}
+  if len(parsedTree.children) == 0 {
+    return currNode, nil
+  }
+  if currNode.name == "" {
+    currNode.name = "Ancestor"
+  }
+
+  children := make([]*node, len(parsedTree.children))
+  distances := make([]float64, len(parsedTree.children))
+  for i, parsedChild := range parsedTree.children {
+    parsedChild = MergeSingleChildren(parsedChild)
+    child, err := BuildBinaryTree(parsedChild, rng)
+    if err != nil {
+      return nil, err
+    }
+    children[i], distances[i] = child, parsedChild.branchLength
+  }
+  if len(children) > 2 {
+    if rng == nil {
+      nodeName := "an internal node"
+      if parsedTree.name != "" {
+        nodeName = "the node " + parsedTree.name
+      }
+      return nil, errors.New(nodeName + " has " + strconv.Itoa(len(children)) + " children, but only binary trees are supported")
+    }
+    // Random pairs of children are joined under new nodes until only two of them are left
+    for len(children) > 2 {
+      i := rng.IntN(len(children))
+      j := rng.IntN(len(children)-1)
+      if j >= i {
+        j++
+      }
+      joinedNode := &node{name:"Ancestor", leftChild:children[i], rightChild:children[j],
+                          leftChildDistance:distances[i], rightChildDistance:distances[j]}
+      joinedNode.leftChild.parent, joinedNode.rightChild.parent = joinedNode, joinedNode
+      if i > j {
+        i, j = j, i
+      }
+      children[i], distances[i] = joinedNode, 0
+      children = append(children[:j], children[j+1:]...)
+      distances = append(distances[:j], distances[j+1:]...)
+    }
+  }
+  currNode.leftChild, currNode.rightChild = children[0], children[1]
+  currNode.leftChildDistance, currNode.rightChildDistance = distances[0], distances[1]
+  currNode.leftChild.parent, currNode.rightChild.parent = currNode, currNode
+  return currNode, nil
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * Breaks a text holding any number of Newick trees into the single trees, each ending with its ';'.
+ * Semicolons within quoted names or comments do not end a tree.
+ *------------------------------------------------------------------------------------------------------*/
+func SplitNewickTrees(text string) []string {
+  trees := make([]string, 0)
+  inQuotes, commentDepth, start := false, 0, 0
+  for i:=0; i<len(text); i++ {
+    switch c := text[i]; {
+    case inQuotes:
+      inQuotes = c != '\''
+    case c == '\'':
+      inQuotes = true
+    case c == '[':
+      commentDepth++
+    case c == ']' && commentDepth > 0:
+      commentDepth--
+    case c == ';' && commentDepth == 0:
+      trees = append(trees, strings.TrimSpace(text[start:i+1]))
+      start = i+1
+    }
+  }
+  if strings.TrimSpace(text[start:]) != "" {
+    trees = append(trees, strings.TrimSpace(text[start:]))
+  }
+  return trees
+}
+
+// A node with a single child is merged into it, adding up the branch lengths on the way
+func MergeSingleChildren(parsedTree *newickNode) *newickNode {
+  for len(parsedTree.children) == 1 {
+    child := *parsedTree.children[0]
+    child.branchLength += parsedTree.branchLength
+    parsedTree = &child
+  }
+  return parsedTree
+}
+
+// Names holding whitespace or any of the punctuation of the format are written within single quotes
+func QuoteNewickName(name string) string {
+  if strings.ContainsAny(name, " \t\n\r'()[]:;,") {
+    return "'" + strings.ReplaceAll(name, "'", "''") + "'"
+  }
+  return name
+}
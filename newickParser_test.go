@@ -0,0 +1,119 @@
+package main
+
+import (
+  "math/rand/v2"
+  "strings"
+  "testing"
+)
+
+// Fails the test unless both trees have the same shape, names and branch lengths, with the children in the same order
+func CheckSameTree(t *testing.T, tree, expected *node) {
+  t.Helper()
+  var compare func(currNode, expectedNode *node, path string)
+  compare = func(currNode, expectedNode *node, path string) {
+    if currNode.name != expectedNode.name {
+      t.Errorf("the node at %s is named %q, expected %q", path, currNode.name, expectedNode.name)
+    }
+    isLeaf, expectedLeaf := currNode.leftChild == nil && currNode.rightChild == nil, expectedNode.leftChild == nil && expectedNode.rightChild == nil
+    if isLeaf != expectedLeaf {
+      t.Errorf("the node at %s is a leaf: %t, expected %t", path, isLeaf, expectedLeaf)
+      return
+    }
+    if isLeaf {
+      return
+    }
+    if currNode.leftChildDistance != expectedNode.leftChildDistance || currNode.rightChildDistance != expectedNode.rightChildDistance {
+      t.Errorf("the branches below %s have lengths %v and %v, expected %v and %v", path, currNode.leftChildDistance,
+               currNode.rightChildDistance, expectedNode.leftChildDistance, expectedNode.rightChildDistance)
+    }
+    if currNode.leftChild.parent != currNode || currNode.rightChild.parent != currNode {
+      t.Errorf("the children of the node at %s do not point back to it", path)
+    }
+    compare(currNode.leftChild, expectedNode.leftChild, path + "/left")
+    compare(currNode.rightChild, expectedNode.rightChild, path + "/right")
+  }
+  if tree.parent != nil {
+    t.Errorf("the root of the tree has a parent")
+  }
+  compare(tree, expected, "root")
+}
+
+func TestParseNewickTree(t *testing.T) {
+  root := ParseNewickTree("((A:0.1,'B C':0.25)x:0.3,D:0.4);", nil)
+  a, bc := &node{name:"A"}, &node{name:"B C"}
+  x := &node{name:"x", leftChild:a, rightChild:bc, leftChildDistance:0.1, rightChildDistance:0.25}
+  d := &node{name:"D"}
+  expected := &node{name:"Ancestor", leftChild:x, rightChild:d, leftChildDistance:0.3, rightChildDistance:0.4}
+  a.parent, bc.parent, x.parent, d.parent = x, x, expected, expected
+  CheckSameTree(t, root, expected)
+}
+
+func TestNewickRoundTrip(t *testing.T) {
+  tests := []struct {
+    name string
+    newick string
+  }{
+    {"plain", "((human:0.01,chimp:0.02):0.005,(gorilla:0.03,orangutan:0.04):0.01);"},
+    {"quoted names", "(('Homo sapiens':0.1,'Pan (troglodytes)':0.2):0.05,('Coquerel''s sifaka':0.3,'a,b;c':0.4):0.06);"},
+    {"comments", "[&R] ((A:0.1[support 0.9],B[no length]:0.2):0.3,[before] C:0.4) [after];"},
+    {"internal node labels", "(((A:0.1,B:0.2)AB:0.3,C:0.4)'node ABC':0.5,D:0.6)root;"},
+    {"bare topology", "((A,B),(C,(D,E)));"},
+    {"single child", "(((A:0.125):0.25,B:0.3):0.1,C:0.4);"},
+  }
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      root := ParseNewickTree(test.newick, nil)
+      newick := NewickFormatTreeRepresentation(root)
+      CheckSameTree(t, ParseNewickTree(newick, nil), root)
+    })
+  }
+}
+
+func TestNewickMultifurcation(t *testing.T) {
+  newick := "(A:0.1,B:0.2,C:0.3,(D:0.4,E:0.5,F:0.6)G:0.7);"
+  if _, err := BuildBinaryTreeFromNewick(newick, nil); err == nil {
+    t.Errorf("a node with more than two children was accepted without a random number generator")
+  }
+
+  root := ParseNewickTree(newick, rand.New(rand.NewPCG(5, 5)))
+  // The same seed resolves the tree the same way
+  CheckSameTree(t, ParseNewickTree(newick, rand.New(rand.NewPCG(5, 5))), root)
+  // The resolved tree is binary, so it reads back without any generator
+  CheckSameTree(t, ParseNewickTree(NewickFormatTreeRepresentation(root), nil), root)
+
+  lengths := make(map[string]float64)
+  var numZeroBranches int
+  var collect func(currNode *node, length float64)
+  collect = func(currNode *node, length float64) {
+    if currNode.leftChild == nil && currNode.rightChild == nil {
+      lengths[currNode.name] = length
+      return
+    }
+    for _, distance := range []float64{currNode.leftChildDistance, currNode.rightChildDistance} {
+      if distance == 0 {
+        numZeroBranches++
+      }
+    }
+    collect(currNode.leftChild, currNode.leftChildDistance)
+    collect(currNode.rightChild, currNode.rightChildDistance)
+  }
+  collect(root, 0)
+  // Every leaf keeps its branch, and each of the two nodes resolved adds branches of length zero
+  for i, name := range strings.Split("ABCDEF", "") {
+    if expected := []float64{0.1, 0.2, 0.3, 0.4, 0.5, 0.6}[i]; lengths[name] != expected {
+      t.Errorf("the branch of %s has length %v, expected %v", name, lengths[name], expected)
+    }
+  }
+  if numZeroBranches != 3 {
+    t.Errorf("the resolved tree has %d branches of length zero, expected 3", numZeroBranches)
+  }
+}
+
+// Parses a Newick string into a binary tree, returning the error instead of exiting
+func BuildBinaryTreeFromNewick(newick string, rng *rand.Rand) (*node, error) {
+  parsedTree, err := ParseNewick(newick)
+  if err != nil {
+    return nil, err
+  }
+  return BuildBinaryTree(parsedTree, rng)
+}
@@ -0,0 +1,456 @@
+package main
+
+import (
+  "fmt"
+  "os"
+  "strconv"
+  "strings"
+)
+
+// A topology stored in the TREES block of a NEXUS file; any TRANSLATE table has already been applied
+type referenceTree struct {
+  name string
+  newick string
+}
+
+// A single NEXUS command, ie. everything between two semicolons, along with the line it started on
+type nexusCommand struct {
+  text string
+  line int
+}
+
+// The settings of the FORMAT command that affect how the matrix has to be read
+type nexusFormat struct {
+  datatype string
+  missing, gap, matchchar byte
+  interleave bool
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * Parses a NEXUS file and extracts the aligned sequences from its DATA or CHARACTERS block along with the
+ * topologies of any TREES block. The gap and missing symbols declared in the FORMAT command are converted
+ * to '-' and '?' respectively and match characters are replaced by the base of the first sequence, so the
+ * rest of the program never has to know about the original file settings.
+ *------------------------------------------------------------------------------------------------------*/
+func ParseNexusFile(lines []string) (parsedAlignment, []referenceTree) {
+  firstLine := ""
+  for _, line := range lines {
+    if strings.TrimSpace(line) != "" {
+      firstLine = strings.TrimSpace(line)
+      break
+    }
+  }
+  if !strings.EqualFold(firstLine, "#NEXUS") {
+    fmt.Println("Invalid NEXUS format; the file needs to begin with #NEXUS")
+    os.Exit(1)
+  }
+
+  commands := SplitNexusCommands(lines)
+  alignment := NewParsedAlignment()
+  matrixFound := false
+  trees := make([]referenceTree, 0)
+  taxaBlockCount := 0
+  taxonLabels := make(map[string]bool)
+  currBlock := ""
+  numTaxa, numSites := 0, 0
+  dimensionsLine := 0
+  format := nexusFormat{datatype:"dna", missing:'?', gap:'-'}
+  translateTable := make(map[string]string)
+
+  for _, command := range commands {
+    keyword, body := nextNexusWord(command.text)
+    // The #NEXUS token is not terminated by a semicolon, so it ends up in front of the first command
+    if strings.EqualFold(keyword, "#nexus") {
+      keyword, body = nextNexusWord(body)
+    }
+    keyword = strings.ToLower(keyword)
+
+    switch {
+    case keyword == "":
+      continue
+    case keyword == "begin":
+      blockName, _ := nextNexusWord(body)
+      currBlock = strings.ToLower(blockName)
+      continue
+    case keyword == "end" || keyword == "endblock":
+      currBlock = ""
+      continue
+    }
+
+    switch currBlock {
+    case "taxa":
+      if keyword == "dimensions" {
+        options := ParseNexusOptions(body)
+        taxaBlockCount, _ = strconv.Atoi(options["ntax"])
+      }
+      if keyword == "taxlabels" {
+        for label, rest := nextNexusWord(body); label != ""; label, rest = nextNexusWord(rest) {
+          taxonLabels[label] = true
+        }
+      }
+
+    case "data", "characters":
+      switch keyword {
+      case "dimensions":
+        options := ParseNexusOptions(body)
+        dimensionsLine = command.line
+        if val, exists := options["ntax"]; exists {
+          numTaxa, _ = strconv.Atoi(val)
+        }
+        if val, exists := options["nchar"]; exists {
+          numSites, _ = strconv.Atoi(val)
+        }
+      case "format":
+        format = ParseNexusFormat(body, command.line)
+      case "matrix":
+        if numTaxa == 0 {
+          numTaxa = taxaBlockCount
+        }
+        alignment = ParseNexusMatrix(body, command.line, numSites, format, taxonLabels)
+        alignment.declaredLength, alignment.declarationLine = numSites, dimensionsLine
+        if numTaxa > 0 {
+          alignment.declaredCount = numTaxa
+        }
+        matrixFound = true
+      }
+
+    case "trees":
+      switch keyword {
+      case "translate":
+        for _, entry := range splitNexusList(body) {
+          key, rest := nextNexusWord(entry)
+          label, _ := nextNexusWord(rest)
+          if key != "" && label != "" {
+            translateTable[key] = label
+          }
+        }
+      case "tree", "utree":
+        name, rest := nextNexusWord(body)
+        // A '*' in front of the name only marks the default tree of the block
+        if name == "*" {
+          name, rest = nextNexusWord(rest)
+        }
+        equalIndex := strings.Index(rest, "=")
+        if equalIndex < 0 {
+          fmt.Println("Invalid NEXUS format; tree definition without '=' at line:" + strconv.Itoa(command.line))
+          os.Exit(1)
+        }
+        newick := strings.TrimSpace(rest[equalIndex+1:])
+        trees = append(trees, referenceTree{name:name, newick:TranslateNewickLabels(newick, translateTable) + ";"})
+      }
+    }
+  }
+
+  // A file holding nothing but trees is fine as long as only its trees are asked for
+  if !matrixFound {
+    alignment.diagnostics = append(alignment.diagnostics, alignmentDiagnostic{line:1,
+                                   message:"no MATRIX was found in a DATA or CHARACTERS block"})
+  }
+  return alignment, trees
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * Fetches only the reference topologies stored in the TREES block of a NEXUS file, which does not need
+ * to hold an alignment. Other formats cannot hold trees, so an empty list is returned for them.
+ *------------------------------------------------------------------------------------------------------*/
+func LoadReferenceTrees(filename string) []referenceTree {
+  lines := ReadDatasetLines(filename)
+  if DetectAlignmentFormat(filename, lines) != "nexus" {
+    return make([]referenceTree, 0)
+  }
+  _, trees := ParseNexusFile(lines)
+  return trees
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * Breaks the file into its semicolon terminated commands while dropping the square bracket comments.
+ * Quoted words are kept intact, so names are free to contain any of these special characters.
+ *------------------------------------------------------------------------------------------------------*/
+func SplitNexusCommands(lines []string) []nexusCommand {
+  commands := make([]nexusCommand, 0)
+  var currCommand strings.Builder
+  commandLine := 1
+  commandStarted := false
+  commentDepth := 0
+  inQuotes := false
+
+  for i, line := range lines {
+    for j:=0; j<len(line); j++ {
+      c := line[j]
+      switch {
+      case commentDepth > 0:
+        if c == '[' {
+          commentDepth++
+        } else if c == ']' {
+          commentDepth--
+        }
+      case inQuotes:
+        currCommand.WriteByte(c)
+        if c == '\'' {
+          inQuotes = false
+        }
+      case c == '\'':
+        if !commandStarted {
+          commandLine = i+1
+          commandStarted = true
+        }
+        currCommand.WriteByte(c)
+        inQuotes = true
+      case c == '[':
+        commentDepth++
+      case c == ';':
+        commands = append(commands, nexusCommand{text:currCommand.String(), line:commandLine})
+        currCommand.Reset()
+        commandStarted = false
+      default:
+        if !commandStarted && c != ' ' && c != '\t' {
+          commandLine = i+1
+          commandStarted = true
+        }
+        currCommand.WriteByte(c)
+      }
+    }
+    currCommand.WriteByte('\n')
+  }
+  if strings.TrimSpace(currCommand.String()) != "" {
+    commands = append(commands, nexusCommand{text:currCommand.String(), line:commandLine})
+  }
+  return commands
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * Reads the key=value pairs of commands such as DIMENSIONS and FORMAT into a map with lower case keys.
+ * Keys given without a value, like a bare INTERLEAVE, are stored with an empty value.
+ *------------------------------------------------------------------------------------------------------*/
+func ParseNexusOptions(body string) map[string]string {
+  options := make(map[string]string)
+  rest := strings.ReplaceAll(body, "=", " = ")
+  for {
+    var key string
+    key, rest = nextNexusWord(rest)
+    if key == "" {
+      break
+    }
+    key = strings.ToLower(key)
+    options[key] = ""
+    trimmed := strings.TrimSpace(rest)
+    if strings.HasPrefix(trimmed, "=") {
+      var val string
+      val, rest = nextNexusWord(trimmed[1:])
+      options[key] = val
+    }
+  }
+  return options
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * Interprets the FORMAT command; only nucleotide data can be handled by the likelihood model
+ *------------------------------------------------------------------------------------------------------*/
+func ParseNexusFormat(body string, line int) nexusFormat {
+  format := nexusFormat{datatype:"dna", missing:'?', gap:'-'}
+  for key, val := range ParseNexusOptions(body) {
+    switch key {
+    case "datatype":
+      format.datatype = strings.ToLower(val)
+      if format.datatype != "dna" && format.datatype != "rna" && format.datatype != "nucleotide" {
+        fmt.Println("Invalid NEXUS format; unsupported datatype " + val + " at line:" + strconv.Itoa(line))
+        os.Exit(1)
+      }
+    case "missing", "gap", "matchchar":
+      if len(val) != 1 {
+        fmt.Println("Invalid NEXUS format; " + key + " needs to be a single character at line:" + strconv.Itoa(line))
+        os.Exit(1)
+      }
+      if key == "missing" {
+        format.missing = val[0]
+      } else if key == "gap" {
+        format.gap = val[0]
+      } else {
+        format.matchchar = val[0]
+      }
+    case "interleave":
+      format.interleave = val == "" || strings.EqualFold(val, "yes")
+    }
+  }
+  return format
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * Reads the sequences of the MATRIX command. In the interleaved layout every line holds a name followed by
+ * the next chunk of its sequence; otherwise a name is followed by the complete sequence, which may run over
+ * any number of lines. The labels of the TAXA block, when there is one, tell where the next sequence starts.
+ * The line numbers are counted from the line holding the MATRIX keyword.
+ *------------------------------------------------------------------------------------------------------*/
+func ParseNexusMatrix(body string, line, numSites int, format nexusFormat, taxonLabels map[string]bool) parsedAlignment {
+  if numSites < 1 {
+    fmt.Println("Invalid NEXUS format; NCHAR has to be given in the DIMENSIONS command before the MATRIX at line:" + strconv.Itoa(line))
+    os.Exit(1)
+  }
+  names := make([]string, 0)
+  nameLines := make([]int, 0)
+  sequences := make([]*strings.Builder, 0)
+
+  if format.interleave {
+    nameIndices := make(map[string]int)
+    for i, matrixLine := range strings.Split(body, "\n") {
+      name, rest := nextNexusWord(matrixLine)
+      if name == "" {
+        continue
+      }
+      index, exists := nameIndices[name]
+      if !exists {
+        index = len(names)
+        nameIndices[name] = index
+        names = append(names, name)
+        nameLines = append(nameLines, line+i)
+        sequences = append(sequences, &strings.Builder{})
+      }
+      sequences[index].WriteString(stripPhylipWhitespace(rest))
+    }
+  } else {
+    // A sequence can be wrapped over several lines. The lines after that of the name only continue it while it is
+    // still short and they neither start with the name of a taxon nor hold more characters than are missing, so that
+    // a sequence that is too short ends at its own line instead of taking in the name of the next taxon.
+    matrixLines := strings.Split(body, "\n")
+    for i:=0; i<len(matrixLines); i++ {
+      name, rest := nextNexusWord(matrixLines[i])
+      if name == "" {
+        continue
+      }
+      names = append(names, name)
+      nameLines = append(nameLines, line+i)
+      sequence := &strings.Builder{}
+      sequence.WriteString(stripPhylipWhitespace(rest))
+      for sequence.Len() < numSites && i+1 < len(matrixLines) {
+        nextWord, _ := nextNexusWord(matrixLines[i+1])
+        continuation := stripPhylipWhitespace(matrixLines[i+1])
+        if taxonLabels[nextWord] || sequence.Len() + len(continuation) > numSites {
+          break
+        }
+        sequence.WriteString(continuation)
+        i++
+      }
+      sequences = append(sequences, sequence)
+    }
+  }
+
+  alignment := NewParsedAlignment()
+  for i, name := range names {
+    sequence := []byte(sequences[i].String())
+    for j:=0; j<len(sequence); j++ {
+      switch {
+      case format.matchchar != 0 && sequence[j] == format.matchchar:
+        if i == 0 || j >= len(alignment.speciesList[0].nucleotideSequence) {
+          alignment.diagnostics = append(alignment.diagnostics, alignmentDiagnostic{line:nameLines[i],
+                                         message:"match character at site " + strconv.Itoa(j+1) + " of " + name + " has no base to refer to"})
+          continue
+        }
+        sequence[j] = alignment.speciesList[0].nucleotideSequence[j]
+      case sequence[j] == format.gap:
+        sequence[j] = '-'
+      case sequence[j] == format.missing:
+        sequence[j] = '?'
+      case format.datatype == "rna" && (sequence[j] == 'U' || sequence[j] == 'u'):
+        sequence[j] -= 'U' - 'T'
+      }
+    }
+    alignment.AddSequence(name, string(sequence), nameLines[i])
+  }
+  return alignment
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * Replaces the leaf labels of a Newick string according to the TRANSLATE table of the TREES block.
+ * Only labels that directly follow a '(' or ',' are leaves; those after a ')' name internal nodes.
+ *------------------------------------------------------------------------------------------------------*/
+func TranslateNewickLabels(newick string, translateTable map[string]string) string {
+  if len(translateTable) == 0 {
+    return newick
+  }
+  var translated strings.Builder
+  var previous byte = '('
+  for i:=0; i<len(newick); {
+    c := newick[i]
+    if strings.IndexByte("():,; \t\n\r", c) >= 0 {
+      translated.WriteByte(c)
+      if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+        previous = c
+      }
+      i++
+      continue
+    }
+    // Branch lengths are copied over as they are
+    if previous == ':' {
+      j := i
+      for j < len(newick) && strings.IndexByte("(),; \t\n\r", newick[j]) < 0 {
+        j++
+      }
+      translated.WriteString(newick[i:j])
+      i = j
+      continue
+    }
+    label, rest := nextNexusWord(newick[i:])
+    labelLength := len(newick) - i - len(rest)
+    if replacement, exists := translateTable[label]; exists && (previous == '(' || previous == ',') {
+      translated.WriteString(QuoteNewickName(replacement))
+    } else {
+      translated.WriteString(newick[i:i+labelLength])
+    }
+    previous = 'l'
+    i += labelLength
+  }
+  return translated.String()
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * Returns the first word of the given text along with the remaining text. A word is either a quoted
+ * string, in which two single quotes stand for one, or a run of characters up to whitespace or punctuation.
+ *------------------------------------------------------------------------------------------------------*/
+func nextNexusWord(text string) (string, string) {
+  i := 0
+  for i < len(text) && (text[i] == ' ' || text[i] == '\t' || text[i] == '\n' || text[i] == '\r') {
+    i++
+  }
+  if i == len(text) {
+    return "", ""
+  }
+  if text[i] == '\'' {
+    var word strings.Builder
+    for j:=i+1; j<len(text); j++ {
+      if text[j] == '\'' {
+        if j+1 < len(text) && text[j+1] == '\'' {
+          word.WriteByte('\'')
+          j++
+          continue
+        }
+        return word.String(), text[j+1:]
+      }
+      word.WriteByte(text[j])
+    }
+    return word.String(), ""
+  }
+  j := i
+  for j < len(text) && strings.IndexByte(" \t\n\r,=():;", text[j]) < 0 {
+    j++
+  }
+  if j == i {
+    j++
+  }
+  return text[i:j], text[j:]
+}
+
+// Splits a comma separated list, such as the TRANSLATE table, while respecting quoted words
+func splitNexusList(body string) []string {
+  entries := make([]string, 0)
+  inQuotes := false
+  start := 0
+  for i:=0; i<len(body); i++ {
+    if body[i] == '\'' {
+      inQuotes = !inQuotes
+    } else if body[i] == ',' && !inQuotes {
+      entries = append(entries, body[start:i])
+      start = i+1
+    }
+  }
+  return append(entries, body[start:])
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+  "strings"
+  "testing"
+)
+
+func TestParseNexusFile(t *testing.T) {
+  tests := []struct {
+    name string
+    text string
+    expected []speciesGenome
+  }{
+    {"interleaved with match characters",
+     `#NEXUS
+      BEGIN TAXA;
+        DIMENSIONS NTAX=3;
+        TAXLABELS human chimp 'gorilla gorilla';
+      END;
+      BEGIN CHARACTERS;
+        DIMENSIONS NCHAR=12;
+        FORMAT DATATYPE=DNA MISSING=N GAP=~ MATCHCHAR=. INTERLEAVE;
+        MATRIX
+        human     ACGTAC [a comment]
+        chimp     ....~N
+        'gorilla gorilla'  ACG.AC
+
+        human     GTACGT
+        chimp     ...N..
+        'gorilla gorilla'  GTAACG
+      ;
+      END;`,
+     []speciesGenome{{"human", "ACGTACGTACGT"}, {"chimp", "ACGT-?GTA?GT"}, {"gorilla gorilla", "ACGTACGTAACG"}}},
+    {"sequential over several lines",
+     `#NEXUS
+      begin data;
+      dimensions ntax=2 nchar=8;
+      format datatype=rna gap=-;
+      matrix
+      a ACGU
+      ACGU
+      b ACGUAC-U
+      ;
+      end;`,
+     []speciesGenome{{"a", "ACGTACGT"}, {"b", "ACGTAC-T"}}},
+    {"sequential with the labels of the taxa block",
+     `#NEXUS
+      begin taxa;
+      dimensions ntax=3;
+      taxlabels human chimp gorilla;
+      end;
+      begin data;
+      dimensions nchar=8;
+      matrix
+      human ACGT
+      ACGA
+      chimp ACGTAC
+      GT
+      gorilla ACGTACGG
+      ;
+      end;`,
+     []speciesGenome{{"human", "ACGTACGA"}, {"chimp", "ACGTACGT"}, {"gorilla", "ACGTACGG"}}},
+  }
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      alignment, _ := ParseNexusFile(strings.Split(test.text, "\n"))
+      CheckSpeciesList(t, alignment.speciesList, test.expected)
+    })
+  }
+}
+
+func TestParseNexusTrees(t *testing.T) {
+  text := `#NEXUS
+    begin data;
+    dimensions ntax=3 nchar=4;
+    matrix
+    human ACGT
+    chimp ACGA
+    'gorilla gorilla' ACGG
+    ;
+    end;
+    BEGIN TREES;
+      TRANSLATE 1 human, 2 chimp, 3 'gorilla gorilla';
+      TREE * best = [&U] ((1:0.1,2:0.2)anc:0.05,3:0.3);
+      TREE other = (1,(2,3));
+    END;`
+  _, trees := ParseNexusFile(strings.Split(text, "\n"))
+  expected := []referenceTree{{"best", "((human:0.1,chimp:0.2)anc:0.05,'gorilla gorilla':0.3);"},
+                              {"other", "(human,(chimp,'gorilla gorilla'));"}}
+  if len(trees) != len(expected) {
+    t.Fatalf("parsed %d trees, expected %d: %v", len(trees), len(expected), trees)
+  }
+  for i := range expected {
+    if trees[i] != expected[i] {
+      t.Errorf("tree %d is %v, expected %v", i+1, trees[i], expected[i])
+    }
+  }
+}
+
+// A sequential row that is shorter than NCHAR has to end at its own line, rather than take in the name of the next taxon
+func TestParseNexusShortSequentialRow(t *testing.T) {
+  text := `#NEXUS
+    begin data;
+    dimensions ntax=3 nchar=8;
+    matrix
+    human ACGTAC
+    chimp ACGTACGT
+    gorilla ACGTACGG
+    ;
+    end;`
+  alignment, _ := ParseNexusFile(strings.Split(text, "\n"))
+  CheckDiagnostics(t, ValidateAlignment(alignment), []alignmentDiagnostic{{5, "sequence of human has 6 sites instead of 8"}})
+}
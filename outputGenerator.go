@@ -27,7 +27,7 @@ func PaintNewickFormatTree(newickTree string, filename string) {
   f.Close()
 }
 
-func PrintNewickFormatTree(newickTree string) {
+func PrintNewickFormatTree(newickTree string, width, height int) {
   var t *tree.Tree
   var err error
   t, err = newick.NewParser(strings.NewReader(newickTree)).Parse()
@@ -35,9 +35,6 @@ func PrintNewickFormatTree(newickTree string) {
  	  panic(err)
   }
 
-  width := LoadIntConfig("ga.output.draw.width")
-  height := LoadIntConfig("ga.output.draw.height")
-
   d := draw.NewTextTreeDrawer(os.Stdout, width, height, 100, 100, 100, 100)
   l := draw.NewNormalLayout(d, true, true, false, true)
   l.DrawTree(t)
@@ -49,21 +46,33 @@ func PrintNewickFormatTree(newickTree string) {
  * the phylogenetic tree structure
  *------------------------------------------------------------------------------------------------------------------------*/
 func NewickFormatTreeRepresentation(root *node) string {
+  return NewickFormatWithPrecision(root, 5)
+}
+
+/*--------------------------------------------------------------------------------------------------------------------------
+ * The same representation with the branch lengths written to the given number of decimals; a precision of -1 writes them
+ * exactly, so that the tree can be read back without any loss, ie. from a checkpoint. Names are quoted where the format
+ * requires it, and internal nodes carrying a label of their own, ie. one read by ParseNewickTree, are written with it.
+ *------------------------------------------------------------------------------------------------------------------------*/
+func NewickFormatWithPrecision(root *node, precision int) string {
   if root == nil {
     return ""
   }
-  var newickFormat string
-  if root.name == "Ancestor" {
-    newickFormat =  "("
+  format := byte('f')
+  if precision < 0 {
+    format = 'g'
   }
+  var newickFormat string
   if root.leftChild == nil && root.rightChild == nil {
-    newickFormat += root.name
+    newickFormat += QuoteNewickName(root.name)
   } else {
-    newickFormat +=  NewickFormatTreeRepresentation(root.leftChild)  + ":" + strconv.FormatFloat(root.leftChildDistance, 'f', 5, 64) + ","
-    newickFormat +=  NewickFormatTreeRepresentation(root.rightChild) + ":" + strconv.FormatFloat(root.rightChildDistance, 'f', 5, 64)
-  }
-  if root.name == "Ancestor" {
+    newickFormat +=  "("
+    newickFormat +=  NewickFormatWithPrecision(root.leftChild, precision)  + ":" + strconv.FormatFloat(root.leftChildDistance, format, precision, 64) + ","
+    newickFormat +=  NewickFormatWithPrecision(root.rightChild, precision) + ":" + strconv.FormatFloat(root.rightChildDistance, format, precision, 64)
     newickFormat += ")"
+    if root.name != "Ancestor" {
+      newickFormat += QuoteNewickName(root.name)
+    }
   }
   if root.parent == nil {
     newickFormat += ";"
@@ -0,0 +1,143 @@
+package main
+
+import (
+  "fmt"
+  "math"
+  "os"
+)
+
+/*--------------------------------------------------------------------------------------------------------------------------
+ * The Fitch parsimony score of the tree, ie. the smallest number of changes it needs to explain the alignment when every
+ * change costs the same. The state sets of all the site patterns are passed up the tree together; a node takes the
+ * intersection of the sets of its children, or their union at the cost of a change when they have nothing in common. Gaps
+ * are a fifth state, unless they are treated as missing data. The branch lengths play no part.
+ *------------------------------------------------------------------------------------------------------------------------*/
+func FitchParsimonyScore(root *node, alignment *sitePatterns, gapsAsMissing bool) float64 {
+  var score float64
+  FitchStateSets(root, alignment, gapsAsMissing, &score)
+  return score
+}
+
+// The state sets of the subtree as bit masks over A, C, G, T and the gap, one for every site pattern
+func FitchStateSets(currNode *node, alignment *sitePatterns, gapsAsMissing bool, score *float64) []uint8 {
+  stateSets := make([]uint8, len(alignment.patterns))
+  if currNode.leftChild == nil && currNode.rightChild == nil {
+    for p := range stateSets {
+      for i, allowed := range LeafStateSet(currNode, alignment, p, gapsAsMissing) {
+        if allowed {
+          stateSets[p] |= 1 << i
+        }
+      }
+    }
+    return stateSets
+  }
+
+  leftSets := FitchStateSets(currNode.leftChild, alignment, gapsAsMissing, score)
+  rightSets := FitchStateSets(currNode.rightChild, alignment, gapsAsMissing, score)
+  for p := range stateSets {
+    stateSets[p] = leftSets[p] & rightSets[p]
+    if stateSets[p] == 0 {
+      stateSets[p] = leftSets[p] | rightSets[p]
+      *score += alignment.weights[p]
+    }
+  }
+  return stateSets
+}
+
+/*--------------------------------------------------------------------------------------------------------------------------
+ * The Sankoff parsimony score of the tree, ie. the smallest total cost of the changes explaining the alignment, where the
+ * cost of every change is read from the given matrix of the states A, C, G, T and the gap. Every node holds the cheapest
+ * cost of its subtree for each of its states, which is built from those of its children by dynamic programming.
+ *------------------------------------------------------------------------------------------------------------------------*/
+func SankoffParsimonyScore(root *node, alignment *sitePatterns, costs [5][5]float64, gapsAsMissing bool) float64 {
+  numStates := 5
+  if gapsAsMissing {
+    numStates = 4
+  }
+  var score float64
+  for p, stateCosts := range SankoffStateCosts(root, alignment, costs, numStates, gapsAsMissing) {
+    minCost := math.Inf(1)
+    for i:=0; i<numStates; i++ {
+      minCost = math.Min(minCost, stateCosts[i])
+    }
+    score += alignment.weights[p] * minCost
+  }
+  return score
+}
+
+// The cheapest cost of the subtree for every state of its root, one for every site pattern
+func SankoffStateCosts(currNode *node, alignment *sitePatterns, costs [5][5]float64, numStates int, gapsAsMissing bool) [][5]float64 {
+  stateCosts := make([][5]float64, len(alignment.patterns))
+  if currNode.leftChild == nil && currNode.rightChild == nil {
+    for p := range stateCosts {
+      allowedStates := LeafStateSet(currNode, alignment, p, gapsAsMissing)
+      for i:=0; i<numStates; i++ {
+        if !allowedStates[i] {
+          stateCosts[p][i] = math.Inf(1)
+        }
+      }
+    }
+    return stateCosts
+  }
+
+  leftCosts := SankoffStateCosts(currNode.leftChild, alignment, costs, numStates, gapsAsMissing)
+  rightCosts := SankoffStateCosts(currNode.rightChild, alignment, costs, numStates, gapsAsMissing)
+  for p := range stateCosts {
+    for i:=0; i<numStates; i++ {
+      leftCost, rightCost := math.Inf(1), math.Inf(1)
+      for j:=0; j<numStates; j++ {
+        leftCost = math.Min(leftCost, costs[i][j] + leftCosts[p][j])
+        rightCost = math.Min(rightCost, costs[i][j] + rightCosts[p][j])
+      }
+      stateCosts[p][i] = leftCost + rightCost
+    }
+  }
+  return stateCosts
+}
+
+// The states allowed at a leaf of the tree for the given site pattern
+func LeafStateSet(leaf *node, alignment *sitePatterns, pattern int, gapsAsMissing bool) [5]bool {
+  nct, exists := alignment.Nucleotide(leaf.name, pattern)
+  if !exists {
+    fmt.Println("Invalid Tree or Map present")
+    os.Exit(1)
+  }
+  allowedStates, valid := NucleotideStateSet(nct, gapsAsMissing)
+  if !valid {
+    fmt.Println("Invalid nucleotide base detected in input !!")
+    os.Exit(1)
+  }
+  return allowedStates
+}
+
+/*--------------------------------------------------------------------------------------------------------------------------
+ * The cost matrix of the Sankoff parsimony over A, C, G, T and the gap, with a cost for transitions (A-G, C-T), one for
+ * transversions and one for changes to or from a gap
+ *------------------------------------------------------------------------------------------------------------------------*/
+func ParsimonyCostMatrix(transitionCost, transversionCost, gapCost float64) [5][5]float64 {
+  var costs [5][5]float64
+  for i:=0; i<5; i++ {
+    for j:=0; j<5; j++ {
+      switch {
+      case i == j:
+      case i == 4 || j == 4:
+        costs[i][j] = gapCost
+      case i+j == 2 || i+j == 4:
+        // A (0) with G (2), or C (1) with T (3)
+        costs[i][j] = transitionCost
+      default:
+        costs[i][j] = transversionCost
+      }
+    }
+  }
+  return costs
+}
+
+// The parsimony score of the tree under the method of the config
+func ParsimonyScore(root *node, alignment *sitePatterns, config *gaConfig) float64 {
+  if config.parsimonyMethod == "sankoff" {
+    costs := ParsimonyCostMatrix(config.transitionCost, config.transversionCost, config.gapCost)
+    return SankoffParsimonyScore(root, alignment, costs, config.gapsAsMissing)
+  }
+  return FitchParsimonyScore(root, alignment, config.gapsAsMissing)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+  "math/rand/v2"
+  "testing"
+)
+
+func TestParsimonyScores(t *testing.T) {
+  grouped, crossed := "((a,b),(c,d));", "((a,c),(b,d));"
+  unitCosts, transversionCosts := ParsimonyCostMatrix(1, 1, 1), ParsimonyCostMatrix(1, 2, 3)
+  tests := []struct {
+    name string
+    tree string
+    sequences []string
+    costs [5][5]float64
+    fitch, sankoff float64
+  }{
+    // A single site grouping a with b and c with d needs one change on the tree with the same split
+    {"informative site", grouped, []string{"A", "A", "G", "G"}, unitCosts, 1, 1},
+    {"informative site on the other tree", crossed, []string{"A", "A", "G", "G"}, unitCosts, 2, 2},
+    // Constant sites cost nothing and a base found in a single taxon costs one change on any tree
+    {"uninformative sites", crossed, []string{"AAC", "AAC", "AAC", "ATG"}, unitCosts, 2, 2},
+    // The informative site is counted twice, as a pattern of weight two
+    {"repeated site", grouped, []string{"AAC", "AAC", "GGC", "GGT"}, unitCosts, 3, 3},
+    // A transition costs 1, a transversion 2 and a gap 3
+    {"transition", grouped, []string{"A", "A", "G", "G"}, transversionCosts, 1, 1},
+    {"transversion", grouped, []string{"A", "A", "C", "C"}, transversionCosts, 1, 2},
+    {"gap", grouped, []string{"A", "A", "-", "-"}, transversionCosts, 1, 3},
+  }
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      speciesList := make([]speciesGenome, len(test.sequences))
+      for i, sequence := range test.sequences {
+        speciesList[i] = speciesGenome{name:string(rune('a' + i)), nucleotideSequence:sequence}
+      }
+      root := ParseNewickTree(test.tree, nil)
+      alignment := CompressSitePatterns(speciesList, 0)
+      if score := FitchParsimonyScore(root, alignment, false); score != test.fitch {
+        t.Errorf("Fitch score %v, expected %v", score, test.fitch)
+      }
+      if score := SankoffParsimonyScore(root, alignment, test.costs, false); score != test.sankoff {
+        t.Errorf("Sankoff score %v, expected %v", score, test.sankoff)
+      }
+    })
+  }
+}
+
+func TestGapsAsMissingInParsimony(t *testing.T) {
+  speciesList := []speciesGenome{
+    {name:"a", nucleotideSequence:"A"},
+    {name:"b", nucleotideSequence:"-"},
+    {name:"c", nucleotideSequence:"G"},
+    {name:"d", nucleotideSequence:"-"},
+  }
+  root := ParseNewickTree("((a,b),(c,d));", nil)
+  alignment := CompressSitePatterns(speciesList, 0)
+  // Missing data fits any state, so only A and G need a change between them
+  if score := FitchParsimonyScore(root, alignment, true); score != 1 {
+    t.Errorf("Fitch score %v with gaps as missing data, expected 1", score)
+  }
+  // As a fifth state, with gaps at the inner nodes A and G need a change each
+  if score := FitchParsimonyScore(root, alignment, false); score != 2 {
+    t.Errorf("Fitch score %v with gaps as a state, expected 2", score)
+  }
+}
+
+// With every change costing one, the Sankoff algorithm has to find the same score as Fitch's
+func TestSankoffWithUnitCostsMatchesFitch(t *testing.T) {
+  rng := rand.New(rand.NewPCG(13, 13))
+  unitCosts := ParsimonyCostMatrix(1, 1, 1)
+  for trial:=0; trial<10; trial++ {
+    speciesList := RandomSpeciesList(9, 50, "ACGT-RN", rng)
+    root := RandomBinaryTree(speciesList, rng)
+    alignment := CompressSitePatterns(speciesList, 0)
+    for _, gapsAsMissing := range []bool{false, true} {
+      fitch := FitchParsimonyScore(root, alignment, gapsAsMissing)
+      if sankoff := SankoffParsimonyScore(root, alignment, unitCosts, gapsAsMissing); sankoff != fitch {
+        t.Errorf("trial %d, gaps as missing %t: Sankoff score %v, Fitch score %v", trial, gapsAsMissing, sankoff, fitch)
+      }
+    }
+  }
+}
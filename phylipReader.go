@@ -0,0 +1,147 @@
+package main
+
+import (
+  "fmt"
+  "os"
+  "strconv"
+  "strings"
+)
+
+// The number of characters reserved for the species name in strict PHYLIP files
+const strictPhylipNameLength = 10
+
+/*-------------------------------------------------------------------------------------------------------
+ * Parses PHYLIP alignments. The header line holds the number of taxa and the number of sites, followed by
+ * the sequences in either the sequential or the interleaved layout. Names can be in the strict form (the
+ * first 10 characters of a line) or the relaxed form (everything up to the first whitespace). As the files
+ * themselves do not say which of these variants is used, each of them is tried in turn and the first one
+ * that yields sequences of the declared length is accepted.
+ *------------------------------------------------------------------------------------------------------*/
+func ParsePhylipAlignment(lines []string) parsedAlignment {
+  headerIndex := 0
+  for headerIndex < len(lines) && strings.TrimSpace(lines[headerIndex]) == "" {
+    headerIndex++
+  }
+  if headerIndex == len(lines) {
+    fmt.Println("Invalid PHYLIP format; the input file is empty")
+    os.Exit(1)
+  }
+  headerInfo := strings.Fields(lines[headerIndex])
+  if len(headerInfo) < 2 {
+    fmt.Println("Invalid PHYLIP format; the header line needs to hold the number of taxa and sites")
+    os.Exit(1)
+  }
+  numTaxa, err1 := strconv.Atoi(headerInfo[0])
+  numSites, err2 := strconv.Atoi(headerInfo[1])
+  if err1 != nil || err2 != nil || numTaxa < 1 || numSites < 1 {
+    fmt.Println("Invalid PHYLIP format; the header line needs to hold the number of taxa and sites")
+    os.Exit(1)
+  }
+
+  // Blank lines only separate the blocks of interleaved files, so they are dropped along with their
+  // line numbers being kept for the error messages
+  dataLines := make([]string, 0)
+  lineNumbers := make([]int, 0)
+  for i:=headerIndex+1; i<len(lines); i++ {
+    if strings.TrimSpace(lines[i]) != "" {
+      dataLines = append(dataLines, lines[i])
+      lineNumbers = append(lineNumbers, i+1)
+    }
+  }
+
+  var firstError string
+  for _, strictNames := range []bool{false, true} {
+    for _, interleaved := range []bool{false, true} {
+      alignment, errMessage := parsePhylipLayout(dataLines, lineNumbers, numTaxa, numSites, strictNames, interleaved)
+      if errMessage == "" {
+        alignment.declaredCount, alignment.declaredLength = numTaxa, numSites
+        alignment.declarationLine = headerIndex+1
+        return alignment
+      }
+      if firstError == "" {
+        firstError = errMessage
+      }
+    }
+  }
+  fmt.Println("Invalid PHYLIP format; " + firstError)
+  os.Exit(1)
+  return parsedAlignment{}
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * Attempts to read the sequences with one particular combination of name style and layout. An empty error
+ * message is returned when the data fits the header exactly.
+ *------------------------------------------------------------------------------------------------------*/
+func parsePhylipLayout(dataLines []string, lineNumbers []int, numTaxa, numSites int, strictNames, interleaved bool) (parsedAlignment, string) {
+  names := make([]string, numTaxa)
+  nameLines := make([]int, numTaxa)
+  sequences := make([]strings.Builder, numTaxa)
+  lineIndex := 0
+
+  for t:=0; t<numTaxa; t++ {
+    if lineIndex >= len(dataLines) {
+      return parsedAlignment{}, "expected " + strconv.Itoa(numTaxa) + " sequences but found " + strconv.Itoa(t)
+    }
+    name, sequence := splitPhylipLine(dataLines[lineIndex], strictNames)
+    if name == "" {
+      return parsedAlignment{}, "missing species name at line:" + strconv.Itoa(lineNumbers[lineIndex])
+    }
+    names[t], nameLines[t] = name, lineNumbers[lineIndex]
+    sequences[t].WriteString(sequence)
+    lineIndex++
+
+    // In the sequential layout a sequence keeps going over the following lines until it is complete
+    for !interleaved && sequences[t].Len() < numSites && lineIndex < len(dataLines) {
+      sequences[t].WriteString(stripPhylipWhitespace(dataLines[lineIndex]))
+      lineIndex++
+    }
+    if !interleaved && sequences[t].Len() != numSites {
+      return parsedAlignment{}, "sequence of " + name + " has " + strconv.Itoa(sequences[t].Len()) + " sites instead of the declared " +
+                  strconv.Itoa(numSites) + " (ending at line:" + strconv.Itoa(lineNumbers[lineIndex-1]) + ")"
+    }
+  }
+
+  // The remaining blocks of an interleaved file hold the continuation of every sequence in the same order
+  for t:=0; interleaved && lineIndex < len(dataLines); t = (t+1) % numTaxa {
+    sequences[t].WriteString(stripPhylipWhitespace(dataLines[lineIndex]))
+    if sequences[t].Len() > numSites {
+      return parsedAlignment{}, "sequence of " + names[t] + " exceeds the declared " + strconv.Itoa(numSites) + " sites at line:" +
+                  strconv.Itoa(lineNumbers[lineIndex])
+    }
+    lineIndex++
+  }
+  if lineIndex < len(dataLines) {
+    return parsedAlignment{}, "unexpected data after the last sequence at line:" + strconv.Itoa(lineNumbers[lineIndex])
+  }
+
+  alignment := NewParsedAlignment()
+  for t:=0; t<numTaxa; t++ {
+    if sequences[t].Len() != numSites {
+      return parsedAlignment{}, "sequence of " + names[t] + " has " + strconv.Itoa(sequences[t].Len()) + " sites instead of the declared " +
+                  strconv.Itoa(numSites)
+    }
+    alignment.AddSequence(names[t], sequences[t].String(), nameLines[t])
+  }
+  return alignment, ""
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * Separates the species name from the sequence data on the first line of a taxon
+ *------------------------------------------------------------------------------------------------------*/
+func splitPhylipLine(line string, strictNames bool) (string, string) {
+  if strictNames {
+    if len(line) <= strictPhylipNameLength {
+      return strings.TrimSpace(line), ""
+    }
+    return strings.TrimSpace(line[:strictPhylipNameLength]), stripPhylipWhitespace(line[strictPhylipNameLength:])
+  }
+  fields := strings.Fields(line)
+  if len(fields) == 0 {
+    return "", ""
+  }
+  return fields[0], strings.Join(fields[1:], "")
+}
+
+func stripPhylipWhitespace(line string) string {
+  return strings.Join(strings.Fields(line), "")
+}
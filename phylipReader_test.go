@@ -0,0 +1,30 @@
+package main
+
+import (
+  "strings"
+  "testing"
+)
+
+func TestParsePhylipAlignment(t *testing.T) {
+  tests := []struct {
+    name string
+    text string
+    expected []speciesGenome
+  }{
+    {"strict names of 10 characters", "3 8\nHomo sapieACGTACGT\nPan trogloACGTACGA\nGorilla   ACGTAC GG\n",
+     []speciesGenome{{"Homo sapie", "ACGTACGT"}, {"Pan troglo", "ACGTACGA"}, {"Gorilla", "ACGTACGG"}}},
+    {"strict names running into the sequence", "2 4\nchimpanzeeACGT\nbonobo    ACGA\n",
+     []speciesGenome{{"chimpanzee", "ACGT"}, {"bonobo", "ACGA"}}},
+    {"relaxed names", "3 8\nhomo_sapiens ACGTACGT\npan_troglodytes ACGTACGA\ngorilla ACGT ACGG\n",
+     []speciesGenome{{"homo_sapiens", "ACGTACGT"}, {"pan_troglodytes", "ACGTACGA"}, {"gorilla", "ACGTACGG"}}},
+    {"sequential over several lines", "3 12\nhuman    ACGTACGTAC\nGT\nchimp ACGTACGTACGA\ngorilla ACGTAC GTACGG\n",
+     []speciesGenome{{"human", "ACGTACGTACGT"}, {"chimp", "ACGTACGTACGA"}, {"gorilla", "ACGTACGTACGG"}}},
+    {"interleaved", " 3 12\nhuman    ACGTAC\nchimp    ACGTAC\ngorilla  ACGTAC\n\nGTACGT\nGTACGA\nGTAC GG\n",
+     []speciesGenome{{"human", "ACGTACGTACGT"}, {"chimp", "ACGTACGTACGA"}, {"gorilla", "ACGTACGTACGG"}}},
+  }
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      CheckSpeciesList(t, ParsePhylipAlignment(strings.Split(test.text, "\n")).speciesList, test.expected)
+    })
+  }
+}
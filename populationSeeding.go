@@ -0,0 +1,92 @@
+package main
+
+import (
+  "fmt"
+  "math"
+  "math/rand/v2"
+  "os"
+  "strconv"
+)
+
+/*-------------------------------------------------------------------------------------------------------
+ * Builds the seeded part of the initial population. Each source gets its proportion of the population:
+ * the trees of ga.init.trees.file, the NJ or BIONJ tree and the UPGMA tree of the JC69 distances.
+ * The trees of a source are used in turn; the first copy of every tree is kept as it is, while the later
+ * ones are perturbed so that the population does not start out with many identical members. Branches are
+ * kept at a length of at least 0.001, the same floor as the mutations use, as the distance trees can
+ * hold branches of length zero. The trees come without a substitution model, which is added along with
+ * the rest of the population.
+ *------------------------------------------------------------------------------------------------------*/
+func GenerateSeedSolutions(speciesList []speciesGenome, config *gaConfig, rng *rand.Rand) []*node {
+  numSolutions := config.populationCount
+  numSpecies := len(speciesList)
+  population := make([]*node, 0, numSolutions)
+
+  addSeeds := func(source string, trees []*node, proportion float64) {
+    count := min(int(proportion*float64(numSolutions) + 0.5), numSolutions - len(population))
+    if count <= 0 || len(trees) == 0 {
+      return
+    }
+    for i:=0; i<count; i++ {
+      seed := GenerateTreeCopy(trees[i % len(trees)])
+      if i >= len(trees) {
+        seed = PerturbTree(seed, config.seedPerturbation, numSpecies, rng)
+      }
+      ClampBranchLengths(seed, 0.001)
+      population = append(population, seed)
+    }
+    fmt.Println("Seeded " + strconv.Itoa(count) + " of the initial trees from " + source)
+  }
+
+  if config.userSeedProportion > 0 {
+    addSeeds(config.seedTreesFile, LoadSeedTrees(config.seedTreesFile, speciesList, rng), config.userSeedProportion)
+  }
+  if config.njSeedProportion > 0 || config.upgmaSeedProportion > 0 {
+    matrix := ComputeDistanceMatrix(speciesList)
+    if config.njSeedProportion > 0 {
+      addSeeds("the " + config.njSeedMethod + " tree", []*node{DistanceTree(matrix, config.njSeedMethod)}, config.njSeedProportion)
+    }
+    if config.upgmaSeedProportion > 0 {
+      addSeeds("the UPGMA tree", []*node{UPGMATree(matrix)}, config.upgmaSeedProportion)
+    }
+  }
+  return population
+}
+
+// Raises every branch of the tree that is shorter than the given length to it
+func ClampBranchLengths(root *node, minLength float64) {
+  if root == nil || (root.leftChild == nil && root.rightChild == nil) {
+    return
+  }
+  root.leftChildDistance, root.rightChildDistance = math.Max(root.leftChildDistance, minLength), math.Max(root.rightChildDistance, minLength)
+  ClampBranchLengths(root.leftChild, minLength)
+  ClampBranchLengths(root.rightChild, minLength)
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * Reads the user trees for seeding, which have to hold exactly the species of the dataset. Nodes with more
+ * than two children are resolved at random, and bare topologies get a length of 0.1 on every branch.
+ *------------------------------------------------------------------------------------------------------*/
+func LoadSeedTrees(filename string, speciesList []speciesGenome, rng *rand.Rand) []*node {
+  taxa := make([]string, len(speciesList))
+  for i, species := range speciesList {
+    taxa[i] = species.name
+  }
+  trees := make([]*node, 0)
+  for _, tree := range LoadNewickTrees(filename) {
+    root := ParseNewickTree(tree.newick, rng)
+    if problems := ValidateTreeTaxa(root, taxa); len(problems) > 0 {
+      ReportConfigProblems("The tree " + tree.name, problems)
+      os.Exit(1)
+    }
+    if TotalBranchLength(root) == 0 {
+      SetAllBranchLengths(root, 0.1)
+    }
+    trees = append(trees, root)
+  }
+  if len(trees) == 0 {
+    fmt.Println("No trees found in " + filename + " for seeding the initial population")
+    os.Exit(1)
+  }
+  return trees
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+  "flag"
+  "fmt"
+  "math/rand/v2"
+  "os"
+  "sort"
+  "strconv"
+  "strings"
+)
+
+/*-------------------------------------------------------------------------------------------------------
+ * The score command: computes the log likelihood of given trees on an alignment without running the GA,
+ * ie. for comparing a published topology with the result of a run. The trees are read from the tree files
+ * given after the alignment, or from the TREES block of the alignment itself when there are none. With
+ * -optimize, the branch lengths and model parameters of every tree are first optimized on its topology.
+ *   ./GA_Phylogeny score [-optimize] [-config file] [-set property=value ...] alignment [treefile ...]
+ *------------------------------------------------------------------------------------------------------*/
+func RunScoreCommand(arguments []string) {
+  flags := flag.NewFlagSet("score", flag.ExitOnError)
+  configFlag := flags.String("config", "config.txt", "the config file holding the model settings; either JSON or the config.txt format")
+  presetFlag := flags.String("preset", "", "a named set of parameters applied over the config file")
+  var overrides configOverrides
+  flags.Var(&overrides, "set", "property=value overriding a property of the config file; can be repeated")
+  optimizeFlag := flags.Bool("optimize", false, "optimize the branch lengths and model parameters on the fixed topology before scoring")
+  roundsFlag := flags.Int("rounds", 20, "the maximum number of rounds over all the parameters when optimizing")
+  seedFlag := flags.Int64("seed", 1, "seed for resolving nodes with more than two children")
+  flags.Parse(arguments)
+  if flags.NArg() < 1 {
+    fmt.Println("Usage: ./GA_Phylogeny score [flags] alignment [treefile ...]")
+    flags.PrintDefaults()
+    os.Exit(1)
+  }
+
+  config := LoadValidatedConfig(*configFlag, *presetFlag, overrides)
+  speciesList, _ := LoadDatasets(flags.Arg(0))
+  alignment := CompressSitePatterns(speciesList, config.sequenceLengthMax)
+  alignment.numChunks = config.siteThreads
+
+  trees := LoadReferenceTrees(flags.Arg(0))
+  if flags.NArg() > 1 {
+    trees = make([]referenceTree, 0)
+    for _, treeFile := range flags.Args()[1:] {
+      trees = append(trees, LoadNewickTrees(treeFile)...)
+    }
+  }
+  if len(trees) == 0 {
+    fmt.Println("No trees to score; please give a tree file after the alignment")
+    os.Exit(1)
+  }
+
+  taxa := make([]string, 0, alignment.NumTaxa())
+  for name := range alignment.taxonIndices {
+    taxa = append(taxa, name)
+  }
+
+  // Multifurcations are resolved with branches of length zero, which leaves the likelihood of the tree unchanged
+  rng := rand.New(rand.NewPCG(uint64(*seedFlag), uint64(*seedFlag)))
+  for _, tree := range trees {
+    root := ParseNewickTree(tree.newick, rng)
+    if problems := ValidateTreeTaxa(root, taxa); len(problems) > 0 {
+      ReportConfigProblems("The tree " + tree.name, problems)
+      os.Exit(1)
+    }
+    // A bare topology gets the same starting length on every branch, as it could not explain any change otherwise
+    if TotalBranchLength(root) == 0 {
+      SetAllBranchLengths(root, 0.1)
+      fmt.Println("The tree " + tree.name + " has no branch lengths; all of them are set to 0.1")
+    }
+    root.model = NewSubstitutionModel(config.modelName, !config.gapsAsMissing)
+    root.model.SetRateHeterogeneity(config.gammaCategories, config.gammaAlpha, config.invariantProportion)
+
+    score := CalculateMaxLikelihoodScores(root, alignment)
+    fmt.Println("\n" + tree.name + ": log likelihood " + strconv.FormatFloat(score, 'f', 6, 64) + " under " + root.model.Description())
+    if *optimizeFlag {
+      score = OptimizeTreeParameters(root, alignment, *roundsFlag)
+      fmt.Println("  optimized log likelihood " + strconv.FormatFloat(score, 'f', 6, 64))
+      fmt.Println("  " + root.model.ParameterSummary())
+      fmt.Println("  " + NewickFormatTreeRepresentation(root))
+    }
+  }
+}
+
+func TotalBranchLength(root *node) float64 {
+  if root == nil || (root.leftChild == nil && root.rightChild == nil) {
+    return 0
+  }
+  return root.leftChildDistance + root.rightChildDistance + TotalBranchLength(root.leftChild) + TotalBranchLength(root.rightChild)
+}
+
+func SetAllBranchLengths(root *node, branchLength float64) {
+  if root == nil || (root.leftChild == nil && root.rightChild == nil) {
+    return
+  }
+  root.leftChildDistance, root.rightChildDistance = branchLength, branchLength
+  SetAllBranchLengths(root.leftChild, branchLength)
+  SetAllBranchLengths(root.rightChild, branchLength)
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * Checks that the leaves of the tree are exactly the taxa of the alignment, each of them appearing once
+ *------------------------------------------------------------------------------------------------------*/
+func ValidateTreeTaxa(root *node, taxa []string) []string {
+  problems := make([]string, 0)
+  leafCounts := make(map[string]int)
+  for _, name := range CaptureSpecies(root, make([]string, 0)) {
+    leafCounts[name]++
+  }
+  names := make([]string, 0, len(leafCounts))
+  for name := range leafCounts {
+    names = append(names, name)
+  }
+  sort.Strings(names)
+  isTaxon := make(map[string]bool)
+  for _, name := range taxa {
+    isTaxon[name] = true
+  }
+  for _, name := range names {
+    if !isTaxon[name] {
+      problems = append(problems, "the species " + name + " is not part of the alignment")
+    }
+    if leafCounts[name] > 1 {
+      problems = append(problems, "the species " + name + " appears " + strconv.Itoa(leafCounts[name]) + " times")
+    }
+  }
+  missing := make([]string, 0)
+  for _, name := range taxa {
+    if leafCounts[name] == 0 {
+      missing = append(missing, name)
+    }
+  }
+  if len(missing) > 0 {
+    sort.Strings(missing)
+    problems = append(problems, "the species " + strings.Join(missing, ", ") + " of the alignment are missing")
+  }
+  return problems
+}
@@ -0,0 +1,68 @@
+package main
+
+/*-------------------------------------------------------------------------------------------------------
+ * The alignment collapsed into its distinct columns. Identical columns always have the same likelihood,
+ * so it is enough to compute it once for every pattern and weigh it by the number of sites it stands for.
+ *------------------------------------------------------------------------------------------------------*/
+type sitePatterns struct {
+  taxonIndices map[string]int
+  patterns [][]byte      // The bases of every distinct column, in the order of the taxa
+  weights []float64      // The number of sites sharing each pattern
+  numSites int
+  numChunks int          // The number of goroutines the likelihood of a tree is spread over
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * Builds the site patterns of the aligned sequences once at load time. Only the first sequenceLimit sites
+ * are considered, with a limit of zero or less standing for the complete alignment. Bases are compared
+ * regardless of their case.
+ *------------------------------------------------------------------------------------------------------*/
+func CompressSitePatterns(speciesList []speciesGenome, sequenceLimit int) *sitePatterns {
+  alignment := &sitePatterns{taxonIndices:make(map[string]int), patterns:make([][]byte, 0), weights:make([]float64, 0), numChunks:1}
+  if len(speciesList) == 0 {
+    return alignment
+  }
+  sequenceLength := len(speciesList[0].nucleotideSequence)
+  if sequenceLimit > 0 && sequenceLength > sequenceLimit {
+    sequenceLength = sequenceLimit
+  }
+  for i, species := range speciesList {
+    alignment.taxonIndices[species.name] = i
+  }
+
+  patternIndices := make(map[string]int)
+  for j:=0; j<sequenceLength; j++ {
+    column := make([]byte, len(speciesList))
+    for i, species := range speciesList {
+      column[i] = species.nucleotideSequence[j]
+      if column[i] >= 'a' && column[i] <= 'z' {
+        column[i] -= 'a' - 'A'
+      }
+    }
+    index, exists := patternIndices[string(column)]
+    if !exists {
+      index = len(alignment.patterns)
+      patternIndices[string(column)] = index
+      alignment.patterns = append(alignment.patterns, column)
+      alignment.weights = append(alignment.weights, 0)
+    }
+    alignment.weights[index]++
+  }
+  alignment.numSites = sequenceLength
+  return alignment
+}
+
+// The number of taxa in the alignment
+func (alignment *sitePatterns) NumTaxa() int {
+  return len(alignment.taxonIndices)
+}
+
+// The base of the given taxon at the given pattern
+func (alignment *sitePatterns) Nucleotide(name string, pattern int) (byte, bool) {
+  index, exists := alignment.taxonIndices[name]
+  if !exists {
+    return 0, false
+  }
+  return alignment.patterns[pattern][index], true
+}
+
@@ -0,0 +1,314 @@
+package main
+
+import (
+  "fmt"
+  "math"
+  "os"
+  "strconv"
+  "strings"
+  "gonum.org/v1/gonum/mat"
+  "gonum.org/v1/gonum/mathext"
+  "gonum.org/v1/gonum/stat/distuv"
+)
+
+// Indices of the exchangeabilities between the four bases in the substitutionModel
+const (
+  rateAC = iota
+  rateAG
+  rateAT
+  rateCG
+  rateCT
+  rateGT
+)
+
+/*-------------------------------------------------------------------------------------------------------
+ * A time-reversible continuous-time Markov model of nucleotide substitution. The rate matrix is built as
+ * Q[i][j] = r[i][j] * pi[j] and scaled to one expected substitution per unit time, so the branch lengths
+ * of the trees can be read as substitutions per site. When gaps are not treated as missing data, the gap
+ * is modelled as a fifth state exchanging with every base at a common rate.
+ *------------------------------------------------------------------------------------------------------*/
+type substitutionModel struct {
+  name string
+  numStates int
+  exchangeabilities [6]float64
+  gapExchangeability float64
+  frequencies [5]float64
+
+  // Among-site rate heterogeneity: a discrete gamma distribution with the given number of categories (+G)
+  // and a proportion of invariable sites (+I). Either of them is switched off by a count below two or a
+  // proportion of zero respectively.
+  gammaCategories int
+  gammaAlpha float64
+  invariantProportion float64
+  categoryRates, categoryWeights []float64
+
+  // The eigen decomposition of the rate matrix, which is recomputed whenever the parameters change
+  decomposed bool
+  eigenValues [5]float64
+  leftVectors, rightVectors [5][5]float64
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * Creates a model of the given type with its parameters at their starting values. Supported types are
+ * JC69, K80, F81, HKY85, TN93 and GTR.
+ *------------------------------------------------------------------------------------------------------*/
+func NewSubstitutionModel(name string, gapsAsState bool) *substitutionModel {
+  var model substitutionModel
+  model.name = strings.ToUpper(name)
+  switch model.name {
+  case "JC69", "K80", "F81", "HKY85", "TN93", "GTR":
+  default:
+    fmt.Println("Invalid substitution model requested: " + name + " (expected one of JC69, K80, F81, HKY85, TN93, GTR)")
+    os.Exit(1)
+  }
+
+  model.numStates = 4
+  model.frequencies = [5]float64{0.25, 0.25, 0.25, 0.25, 0}
+  if gapsAsState {
+    model.numStates = 5
+    model.frequencies = [5]float64{0.24, 0.24, 0.24, 0.24, 0.04}
+    model.gapExchangeability = 0.5
+  }
+  model.exchangeabilities = [6]float64{1, 1, 1, 1, 1, 1}
+  // Transitions are usually observed more often than transversions
+  if model.name != "JC69" && model.name != "F81" {
+    model.exchangeabilities[rateAG], model.exchangeabilities[rateCT] = 2, 2
+  }
+  model.Constrain()
+  return &model
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * Forces the parameters back into the shape required by the model type after they have been altered,
+ * ie. equal base frequencies for JC69 and K80 or a single transition rate for K80 and HKY85. The
+ * frequencies are normalized and the cached decomposition is dropped.
+ *------------------------------------------------------------------------------------------------------*/
+func (model *substitutionModel) Constrain() {
+  r := &model.exchangeabilities
+  switch model.name {
+  case "JC69", "F81":
+    *r = [6]float64{1, 1, 1, 1, 1, 1}
+  case "K80", "HKY85":
+    kappa := r[rateAG]
+    *r = [6]float64{1, kappa, 1, 1, kappa, 1}
+  case "TN93":
+    r[rateAC], r[rateAT], r[rateCG], r[rateGT] = 1, 1, 1, 1
+  case "GTR":
+    // The G<->T rate is used as the reference that all the others are relative to
+    for i:=0; i<6; i++ {
+      r[i] /= r[rateGT]
+    }
+  }
+  for i:=0; i<6; i++ {
+    r[i] = math.Min(math.Max(r[i], 0.001), 1000)
+  }
+  model.gapExchangeability = math.Min(math.Max(model.gapExchangeability, 0.001), 1000)
+  model.gammaAlpha = math.Min(math.Max(model.gammaAlpha, 0.01), 100)
+  if model.invariantProportion > 0 {
+    model.invariantProportion = math.Min(math.Max(model.invariantProportion, 0.0001), 0.99)
+  }
+
+  var frequencySum float64
+  for i:=0; i<model.numStates; i++ {
+    model.frequencies[i] = math.Max(model.frequencies[i], 0.0001)
+    frequencySum += model.frequencies[i]
+  }
+  for i:=0; i<model.numStates; i++ {
+    model.frequencies[i] /= frequencySum
+  }
+  if model.name == "JC69" || model.name == "K80" {
+    baseFrequency := (1 - model.frequencies[4]) / 4
+    if model.numStates == 4 {
+      baseFrequency = 0.25
+    }
+    for i:=0; i<4; i++ {
+      model.frequencies[i] = baseFrequency
+    }
+  }
+  model.decomposed = false
+  model.categoryRates, model.categoryWeights = nil, nil
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * Switches on the among-site rate heterogeneity of the model with the given starting values
+ *------------------------------------------------------------------------------------------------------*/
+func (model *substitutionModel) SetRateHeterogeneity(gammaCategories int, gammaAlpha, invariantProportion float64) {
+  model.gammaCategories = gammaCategories
+  model.gammaAlpha = gammaAlpha
+  model.invariantProportion = math.Max(invariantProportion, 0)
+  model.Constrain()
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * The relative rates at which the sites can evolve along with the probability of a site belonging to each
+ * of them. The gamma distribution with mean one is cut into categories of equal probability, each of which
+ * is represented by its mean rate (Yang, 1994). The invariable sites form an additional category of rate
+ * zero, and the rates of the others are scaled up so that the mean rate over all the sites stays one.
+ *------------------------------------------------------------------------------------------------------*/
+func (model *substitutionModel) SiteRateCategories() ([]float64, []float64) {
+  if model.categoryRates != nil {
+    return model.categoryRates, model.categoryWeights
+  }
+  rates := []float64{1}
+  if model.gammaCategories > 1 {
+    k := model.gammaCategories
+    gammaDist := distuv.Gamma{Alpha: model.gammaAlpha, Beta: model.gammaAlpha}
+    rates = make([]float64, k)
+    var previousBound float64
+    for c:=0; c<k; c++ {
+      upperBound := 1.0
+      if c < k-1 {
+        upperBound = mathext.GammaIncReg(model.gammaAlpha+1, model.gammaAlpha*gammaDist.Quantile(float64(c+1)/float64(k)))
+      }
+      rates[c] = float64(k) * (upperBound - previousBound)
+      previousBound = upperBound
+    }
+  }
+
+  weights := make([]float64, len(rates))
+  variableProportion := 1 - model.invariantProportion
+  for c:=0; c<len(rates); c++ {
+    rates[c] /= variableProportion
+    weights[c] = variableProportion / float64(len(rates))
+  }
+  if model.invariantProportion > 0 {
+    rates = append(rates, 0)
+    weights = append(weights, model.invariantProportion)
+  }
+  model.categoryRates, model.categoryWeights = rates, weights
+  return rates, weights
+}
+
+// A short description of the model, ie. HKY85+G4+I
+func (model *substitutionModel) Description() string {
+  description := model.name
+  if model.gammaCategories > 1 {
+    description += "+G" + strconv.Itoa(model.gammaCategories)
+  }
+  if model.invariantProportion > 0 {
+    description += "+I"
+  }
+  return description
+}
+
+// The values of all the parameters of the model, ie. for reporting the result of an optimization
+func (model *substitutionModel) ParameterSummary() string {
+  stateNames := []string{"A", "C", "G", "T", "-"}
+  summary := "frequencies"
+  for i:=0; i<model.numStates; i++ {
+    summary += " " + stateNames[i] + "=" + strconv.FormatFloat(model.frequencies[i], 'f', 4, 64)
+  }
+  summary += ", rates"
+  for i, pair := range []string{"AC", "AG", "AT", "CG", "CT", "GT"} {
+    summary += " " + pair + "=" + strconv.FormatFloat(model.exchangeabilities[i], 'f', 4, 64)
+  }
+  if model.numStates == 5 {
+    summary += " gap=" + strconv.FormatFloat(model.gapExchangeability, 'f', 4, 64)
+  }
+  if model.gammaCategories > 1 {
+    summary += ", alpha=" + strconv.FormatFloat(model.gammaAlpha, 'f', 4, 64)
+  }
+  if model.invariantProportion > 0 {
+    summary += ", pinv=" + strconv.FormatFloat(model.invariantProportion, 'f', 4, 64)
+  }
+  return summary
+}
+
+// The exchangeability between two states, including the gap state
+func (model *substitutionModel) Exchangeability(i, j int) float64 {
+  if i == 4 || j == 4 {
+    return model.gapExchangeability
+  }
+  if i > j {
+    i, j = j, i
+  }
+  switch {
+  case i == 0 && j == 1: return model.exchangeabilities[rateAC]
+  case i == 0 && j == 2: return model.exchangeabilities[rateAG]
+  case i == 0 && j == 3: return model.exchangeabilities[rateAT]
+  case i == 1 && j == 2: return model.exchangeabilities[rateCG]
+  case i == 1 && j == 3: return model.exchangeabilities[rateCT]
+  }
+  return model.exchangeabilities[rateGT]
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * Computes the eigen decomposition of the rate matrix. As the model is reversible, the rate matrix is
+ * similar to the symmetric matrix S = diag(sqrt(pi)) Q diag(1/sqrt(pi)), whose decomposition S = U L U'
+ * always exists and is numerically stable. P(t) = exp(Qt) then follows as
+ * diag(1/sqrt(pi)) U exp(Lt) U' diag(sqrt(pi)).
+ *------------------------------------------------------------------------------------------------------*/
+func (model *substitutionModel) Decompose() {
+  n := model.numStates
+  var rateMatrix [5][5]float64
+  var meanRate float64
+  for i:=0; i<n; i++ {
+    for j:=0; j<n; j++ {
+      if i != j {
+        rateMatrix[i][j] = model.Exchangeability(i, j) * model.frequencies[j]
+        rateMatrix[i][i] -= rateMatrix[i][j]
+      }
+    }
+    meanRate -= model.frequencies[i] * rateMatrix[i][i]
+  }
+
+  symmetric := mat.NewSymDense(n, nil)
+  for i:=0; i<n; i++ {
+    for j:=i; j<n; j++ {
+      symmetric.SetSym(i, j, rateMatrix[i][j] * math.Sqrt(model.frequencies[i]/model.frequencies[j]) / meanRate)
+    }
+  }
+  var eigen mat.EigenSym
+  if !eigen.Factorize(symmetric, true) {
+    fmt.Println("Eigen decomposition of the " + model.name + " rate matrix failed!!")
+    os.Exit(1)
+  }
+  var vectors mat.Dense
+  eigen.VectorsTo(&vectors)
+  values := eigen.Values(nil)
+
+  for k:=0; k<n; k++ {
+    model.eigenValues[k] = values[k]
+    for i:=0; i<n; i++ {
+      model.leftVectors[i][k] = vectors.At(i, k) / math.Sqrt(model.frequencies[i])
+      model.rightVectors[k][i] = vectors.At(i, k) * math.Sqrt(model.frequencies[i])
+    }
+  }
+  model.decomposed = true
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * The probabilities of going from every state to every other state over a branch of the given length,
+ * measured in expected substitutions per site.
+ *------------------------------------------------------------------------------------------------------*/
+func (model *substitutionModel) TransitionMatrix(branchLength float64) [5][5]float64 {
+  if !model.decomposed {
+    model.Decompose()
+  }
+  n := model.numStates
+  var expValues [5]float64
+  for k:=0; k<n; k++ {
+    expValues[k] = math.Exp(model.eigenValues[k] * branchLength)
+  }
+  var probabilities [5][5]float64
+  for i:=0; i<n; i++ {
+    for j:=0; j<n; j++ {
+      var p float64
+      for k:=0; k<n; k++ {
+        p += model.leftVectors[i][k] * expValues[k] * model.rightVectors[k][j]
+      }
+      // Rounding errors can leave tiny negative values for very short branches
+      probabilities[i][j] = math.Max(p, 0)
+    }
+  }
+  return probabilities
+}
+
+// A copy of the model that can be mutated independently of the original
+func (model *substitutionModel) Copy() *substitutionModel {
+  if model == nil {
+    return nil
+  }
+  modelCopy := *model
+  return &modelCopy
+}
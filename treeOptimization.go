@@ -0,0 +1,151 @@
+package main
+
+import (
+  "math"
+)
+
+// A single real valued parameter of a tree or its substitution model, along with the range it is searched in
+type treeParameter struct {
+  value *float64
+  low, high float64
+  logScale bool               // Searched on a log scale, ie. over orders of magnitude
+  step float64                // The search only looks this far away from the current value, on the scale of the search
+  model *substitutionModel    // Set for the parameters of the model, which need to be constrained after every change
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * The free parameters of a tree with a fixed topology: the lengths of all its branches along with the
+ * parameters of its substitution model that are not fixed by the model type. The rate between G and T is
+ * the reference of the others, and as the frequencies are normalized afterwards, that of the last state is
+ * left as the reference of theirs; neither of the two is free.
+ *------------------------------------------------------------------------------------------------------*/
+func TreeParameters(root *node) []treeParameter {
+  parameters := make([]treeParameter, 0)
+  var collectBranches func(currNode *node)
+  collectBranches = func(currNode *node) {
+    if currNode == nil || (currNode.leftChild == nil && currNode.rightChild == nil) {
+      return
+    }
+    parameters = append(parameters, treeParameter{value:&currNode.leftChildDistance, low:1e-8, high:10, logScale:true, step:6},
+                                    treeParameter{value:&currNode.rightChildDistance, low:1e-8, high:10, logScale:true, step:6})
+    collectBranches(currNode.leftChild)
+    collectBranches(currNode.rightChild)
+  }
+  collectBranches(root)
+
+  model := root.model
+  var freeRates []int
+  switch model.name {
+  case "K80", "HKY85":
+    freeRates = []int{rateAG}
+  case "TN93":
+    freeRates = []int{rateAG, rateCT}
+  case "GTR":
+    freeRates = []int{rateAC, rateAG, rateAT, rateCG, rateCT}
+  }
+  for _, rate := range freeRates {
+    parameters = append(parameters, treeParameter{value:&model.exchangeabilities[rate], low:0.001, high:1000, logScale:true, step:2, model:model})
+  }
+  if model.numStates == 5 {
+    parameters = append(parameters, treeParameter{value:&model.gapExchangeability, low:0.001, high:1000, logScale:true, step:2, model:model})
+  }
+  if model.name != "JC69" && model.name != "K80" {
+    for i:=0; i<model.numStates-1; i++ {
+      parameters = append(parameters, treeParameter{value:&model.frequencies[i], low:0.0001, high:1, logScale:true, step:1, model:model})
+    }
+  }
+  if model.gammaCategories > 1 {
+    parameters = append(parameters, treeParameter{value:&model.gammaAlpha, low:0.01, high:100, logScale:true, step:2, model:model})
+  }
+  if model.invariantProportion > 0 {
+    parameters = append(parameters, treeParameter{value:&model.invariantProportion, low:0.0001, high:0.99, step:0.2, model:model})
+  }
+  return parameters
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * Maximizes the likelihood of the tree without changing its topology, by optimizing one parameter at a
+ * time while holding all the others fixed. Rounds over all the parameters are repeated until a round
+ * improves the log likelihood by less than 0.001, or the given number of rounds is used up. Returns the
+ * final log likelihood; the tree and its model are left with the optimized values.
+ *------------------------------------------------------------------------------------------------------*/
+func OptimizeTreeParameters(root *node, alignment *sitePatterns, maxRounds int) float64 {
+  score := CalculateMaxLikelihoodScores(root, alignment)
+  for round:=0; round<maxRounds; round++ {
+    previousScore := score
+    for _, parameter := range TreeParameters(root) {
+      score = OptimizeTreeParameter(root, alignment, parameter, score)
+    }
+    if score - previousScore < 0.001 {
+      break
+    }
+  }
+  return score
+}
+
+// Searches the best value of a single parameter, keeping the current one unless a better value is found
+func OptimizeTreeParameter(root *node, alignment *sitePatterns, parameter treeParameter, currentScore float64) float64 {
+  originalValue := *parameter.value
+  var originalModel substitutionModel
+  if parameter.model != nil {
+    originalModel = *parameter.model
+  }
+  setValue := func(x float64) {
+    if parameter.model != nil {
+      *parameter.model = originalModel
+    }
+    *parameter.value = x
+    if parameter.model != nil {
+      parameter.model.Constrain()
+    }
+  }
+
+  transform, inverse := func(x float64) float64 { return x }, func(x float64) float64 { return x }
+  if parameter.logScale {
+    transform, inverse = math.Log, math.Exp
+  }
+  // Searching close to the current value is enough, as the parameters rarely move far once the others settle
+  current := transform(math.Min(math.Max(originalValue, parameter.low), parameter.high))
+  low := math.Max(transform(parameter.low), current - parameter.step)
+  high := math.Min(transform(parameter.high), current + parameter.step)
+  bestValue, bestScore := GoldenSectionMaximum(func(x float64) float64 {
+    setValue(inverse(x))
+    return CalculateMaxLikelihoodScores(root, alignment)
+  }, low, high)
+
+  if bestScore > currentScore {
+    setValue(inverse(bestValue))
+    return bestScore
+  }
+  if parameter.model != nil {
+    *parameter.model = originalModel
+  }
+  *parameter.value = originalValue
+  return currentScore
+}
+
+/*-------------------------------------------------------------------------------------------------------
+ * Finds the maximum of a function of one variable within [low, high] by golden section search, which
+ * only needs the function to have a single peak within the range. Returns the position of the maximum
+ * along with the value there.
+ *------------------------------------------------------------------------------------------------------*/
+func GoldenSectionMaximum(f func(float64) float64, low, high float64) (float64, float64) {
+  ratio := (math.Sqrt(5) - 1) / 2
+  x1, x2 := high - ratio*(high-low), low + ratio*(high-low)
+  f1, f2 := f(x1), f(x2)
+  for i:=0; i<24; i++ {
+    if f1 > f2 {
+      high, x2, f2 = x2, x1, f1
+      x1 = high - ratio*(high-low)
+      f1 = f(x1)
+    } else {
+      low, x1, f1 = x1, x2, f2
+      x2 = low + ratio*(high-low)
+      f2 = f(x2)
+    }
+  }
+  if f1 > f2 {
+    return x1, f1
+  }
+  return x2, f2
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+  "math"
+  "math/rand/v2"
+  "strconv"
+  "testing"
+)
+
+/*-------------------------------------------------------------------------------------------------------
+ * Evolves sequences down the tree under its substitution model: the states at the root are drawn from the
+ * base frequencies, and every child draws its state from the transition probabilities of its branch
+ *------------------------------------------------------------------------------------------------------*/
+func SimulateSequences(root *node, numSites int, rng *rand.Rand) []speciesGenome {
+  model := root.model
+  drawState := func(probabilities []float64) int {
+    u := rng.Float64()
+    for i:=0; i<model.numStates-1; i++ {
+      if u -= probabilities[i]; u < 0 {
+        return i
+      }
+    }
+    return model.numStates - 1
+  }
+  speciesList := make([]speciesGenome, 0)
+  var evolve func(currNode *node, states []int)
+  evolve = func(currNode *node, states []int) {
+    if currNode.leftChild == nil && currNode.rightChild == nil {
+      sequence := make([]byte, numSites)
+      for k, state := range states {
+        sequence[k] = "ACGT-"[state]
+      }
+      speciesList = append(speciesList, speciesGenome{name:currNode.name, nucleotideSequence:string(sequence)})
+      return
+    }
+    for side, child := range []*node{currNode.leftChild, currNode.rightChild} {
+      branchLength := currNode.leftChildDistance
+      if side == 1 {
+        branchLength = currNode.rightChildDistance
+      }
+      probabilities := model.TransitionMatrix(branchLength)
+      childStates := make([]int, numSites)
+      for k, state := range states {
+        childStates[k] = drawState(probabilities[state][:])
+      }
+      evolve(child, childStates)
+    }
+  }
+  rootStates := make([]int, numSites)
+  for k := range rootStates {
+    rootStates[k] = drawState(model.frequencies[:])
+  }
+  evolve(root, rootStates)
+  return speciesList
+}
+
+func TestOptimizeTreeParametersRecoversModel(t *testing.T) {
+  rng := rand.New(rand.NewPCG(3, 3))
+  taxa := make([]speciesGenome, 8)
+  for i := range taxa {
+    taxa[i].name = "taxon" + strconv.Itoa(i)
+  }
+  root := RandomBinaryTree(taxa, rng)
+  SetAllBranchLengths(root, 0.15)
+  root.model = NewSubstitutionModel("HKY85", false)
+  root.model.exchangeabilities[rateAG] = 4
+  root.model.frequencies = [5]float64{0.35, 0.15, 0.2, 0.3, 0}
+  root.model.Constrain()
+  alignment := CompressSitePatterns(SimulateSequences(root, 1000, rng), 0)
+
+  // The optimization starts out from the default model and branch lengths that are far off
+  SetAllBranchLengths(root, 0.05)
+  root.model = NewSubstitutionModel("HKY85", false)
+  score := CalculateMaxLikelihoodScores(root, alignment)
+  for _, parameter := range TreeParameters(root) {
+    newScore := OptimizeTreeParameter(root, alignment, parameter, score)
+    if newScore < score {
+      t.Fatalf("optimizing a parameter lowered the log likelihood from %v to %v", score, newScore)
+    }
+    if actual := CalculateMaxLikelihoodScores(root, alignment); math.Abs(actual - newScore) > 1e-6 {
+      t.Fatalf("the returned log likelihood %v does not match that of the tree, %v", newScore, actual)
+    }
+    score = newScore
+  }
+  if finalScore := OptimizeTreeParameters(root, alignment, 4); finalScore < score {
+    t.Fatalf("further rounds lowered the log likelihood from %v to %v", score, finalScore)
+  }
+
+  if kappa := root.model.exchangeabilities[rateAG]; math.Abs(kappa - 4) > 1 {
+    t.Errorf("kappa was estimated at %v, expected about 4", kappa)
+  }
+  for i, expected := range []float64{0.35, 0.15, 0.2, 0.3} {
+    if frequency := root.model.frequencies[i]; math.Abs(frequency - expected) > 0.03 {
+      t.Errorf("the frequency of %c was estimated at %v, expected about %v", "ACGT"[i], frequency, expected)
+    }
+  }
+}
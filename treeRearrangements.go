@@ -2,29 +2,28 @@ package main
 
 import (
   "fmt"
+  "math"
   "os"
-  "time"
-  "math/rand"
+  "math/rand/v2"
   "gonum.org/v1/gonum/stat/distuv"
 )
 
 /*-----------------------------------------------------------------------------------------------------
  * The abstracted function represting the various types of mutations that are involved in the GA algo
  *---------------------------------------------------------------------------------------------------*/
-func MutateFuturePopulation(parentPopulation, population []*node, numSpecies int) {
+func MutateFuturePopulation(config *gaConfig, parentPopulation, population []*node, numSpecies int, rng *rand.Rand) {
   numSolutions := len(population)
 
-  branchMutationRate := LoadFloatConfig("ga.algo.params.mutation.branchlength")
-  nucleotideMutationRate := LoadFloatConfig("ga.algo.params.mutation.nucleotide")
-  topologyMutationRate := LoadFloatConfig("ga.algo.params.mutation.topology")
-  recombinationProbability := LoadFloatConfig("ga.algo.params.crossover")
+  branchMutationRate := config.branchLengthMutationRate
+  nucleotideMutationRate := config.nucleotideMutationRate
+  topologyMutationRate := config.topologyMutationRate
+  recombinationProbability := config.crossoverRate
 
-  rand.Seed(time.Now().UTC().UnixNano())
   for i:=1; i<numSolutions; i++ {
-    MutateBranches(population[i], branchMutationRate)
-    MutateNucleotideFrequencies(population[i], nucleotideMutationRate)
-    population[i] = MutateTopology(population[i], topologyMutationRate, numSpecies)
-    population[i] = PerformCrossOver(population[i], parentPopulation, recombinationProbability, numSpecies)
+    MutateBranches(population[i], branchMutationRate, rng)
+    MutateSubstitutionModel(population[i].model, nucleotideMutationRate, rng)
+    population[i] = MutateTopology(population[i], topologyMutationRate, numSpecies, rng)
+    population[i] = PerformCrossOver(population[i], parentPopulation, recombinationProbability, numSpecies, rng)
   }
 
 }
@@ -33,22 +32,22 @@ func MutateFuturePopulation(parentPopulation, population []*node, numSpecies int
  * Branch Lengths are mutated with a given probability by multiplying them with a sample drawn from a
  * gamma distribution with alpha = 500 and mean = 1
  *----------------------------------------------------------------------------------------------------*/
-func MutateBranches(solution *node, rate float64)  {
+func MutateBranches(solution *node, rate float64, rng *rand.Rand)  {
   if solution == nil || solution.rightChild == nil || solution.leftChild == nil {
     return
   }
-  leftChance := rand.Float64()
+  leftChance := rng.Float64()
   if leftChance < rate {
-    solution.leftChildDistance *= GammaDistrubution(500, 500)
+    solution.leftChildDistance *= GammaDistrubution(500, 500, rng)
     if solution.leftChildDistance > 1 {
       solution.leftChildDistance = 1
     } else if solution.leftChildDistance <= 0.001 {
       solution.leftChildDistance = 0.001
     }
   }
-  rightChance := rand.Float64()
+  rightChance := rng.Float64()
   if rightChance < rate {
-    solution.rightChildDistance *= GammaDistrubution(500, 500)
+    solution.rightChildDistance *= GammaDistrubution(500, 500, rng)
     // Care has to be taken such that branch lengths do not overflow or become too small
     if solution.rightChildDistance > 1 {
       solution.rightChildDistance = 1
@@ -57,55 +56,79 @@ func MutateBranches(solution *node, rate float64)  {
     }
   }
 
-  MutateBranches(solution.leftChild, rate)
-  MutateBranches(solution.rightChild, rate)
+  MutateBranches(solution.leftChild, rate, rng)
+  MutateBranches(solution.rightChild, rate, rng)
 
 }
 
 /*----------------------------------------------------------------------------------------------------
- * The nucleotide conversion ratios and base frequencies are altered in a similar fashion by multiplying
- * them with samples from the same gamma distribution curves and adjusted such that the net probability
- * for each transition type equals one
+ * Used on the copies of the seed trees of the initial population, so that they do not all start out the
+ * same. Every branch length is multiplied by a gamma sample with mean 1 whose spread grows with the
+ * strength, and the topology gets moved with the strength as its probability.
+ *---------------------------------------------------------------------------------------------------*/
+func PerturbTree(solution *node, strength float64, numSpecies int, rng *rand.Rand) *node {
+  if strength <= 0 {
+    return solution
+  }
+  shape := 1 / (strength * strength)
+  var perturbBranches func(currNode *node)
+  perturbBranches = func(currNode *node) {
+    if currNode == nil || currNode.leftChild == nil || currNode.rightChild == nil {
+      return
+    }
+    currNode.leftChildDistance = math.Max(currNode.leftChildDistance, 0.001) * GammaDistrubution(shape, shape, rng)
+    currNode.rightChildDistance = math.Max(currNode.rightChildDistance, 0.001) * GammaDistrubution(shape, shape, rng)
+    perturbBranches(currNode.leftChild)
+    perturbBranches(currNode.rightChild)
+  }
+  perturbBranches(solution)
+  if numSpecies > 2 {
+    solution = MutateTopology(solution, strength, numSpecies, rng)
+  }
+  return solution
+}
+
+/*----------------------------------------------------------------------------------------------------
+ * The exchangeabilities and base frequencies of the substitution model are altered in a similar fashion
+ * by multiplying them with samples from the same gamma distribution curves, as are the parameters of the
+ * among-site rate variation when it is switched on. The model then restores its
+ * own constraints, so only the free parameters of the chosen model type end up being changed.
  *----------------------------------------------------------------------------------------------------*/
-func MutateNucleotideFrequencies(currentNode *node, nucleotideMutationRate float64) {
-  if currentNode == nil {
+func MutateSubstitutionModel(model *substitutionModel, nucleotideMutationRate float64, rng *rand.Rand) {
+  if model == nil {
     return
   }
-  for i:=0; i<5; i++ {
-    chance := rand.Float64()
+  for i:=0; i<model.numStates; i++ {
+    chance := rng.Float64()
     if chance < nucleotideMutationRate {
-      currentNode.nucleotideFrequencies[i] *= GammaDistrubution(500, 500)
-    }
-    for j:=0; j<5; j++ {
-      chance := rand.Float64()
-      if chance < nucleotideMutationRate {
-          currentNode.conversionRatios[i][j] *= GammaDistrubution(500,500)
-      }
+      model.frequencies[i] *= GammaDistrubution(500, 500, rng)
     }
   }
-  var frequencySum float64
-  var rowSums [5]float64
-  for i:=0; i<5; i++ {
-    frequencySum += currentNode.nucleotideFrequencies[i]
-    for j:=0; j<5; j++ {
-      rowSums[i] += currentNode.conversionRatios[i][j]
+  for i:=0; i<6; i++ {
+    chance := rng.Float64()
+    if chance < nucleotideMutationRate {
+      model.exchangeabilities[i] *= GammaDistrubution(500, 500, rng)
     }
   }
-  for i:=0; i<5; i++ {
-    currentNode.nucleotideFrequencies[i] /= frequencySum
-    for j:=0; j<5; j++ {
-      currentNode.conversionRatios[i][j] /= rowSums[i]
-    }
+  if model.numStates == 5 && rng.Float64() < nucleotideMutationRate {
+    model.gapExchangeability *= GammaDistrubution(500, 500, rng)
+  }
+  // The shape of the among-site rate distribution and the proportion of invariable sites evolve along with the rest
+  if model.gammaCategories > 1 && rng.Float64() < nucleotideMutationRate {
+    model.gammaAlpha *= GammaDistrubution(500, 500, rng)
+  }
+  if model.invariantProportion > 0 && rng.Float64() < nucleotideMutationRate {
+    model.invariantProportion *= GammaDistrubution(500, 500, rng)
   }
-  MutateNucleotideFrequencies(currentNode.leftChild, nucleotideMutationRate)
-  MutateNucleotideFrequencies(currentNode.rightChild, nucleotideMutationRate)
+  model.Constrain()
 }
 
 /*----------------------------------------------------------------------------------------------------
- * An external library has been used for drawing samples from the gamma distribution
+ * An external library has been used for drawing samples from the gamma distribution; the samples are
+ * drawn from the random number generator of the run so that they can be reproduced
  *--------------------------------------------------------------------------------------------------*/
-func GammaDistrubution(alpha, beta float64) float64 {
-  var gammaDist = distuv.Gamma{Alpha: alpha, Beta: beta}
+func GammaDistrubution(alpha, beta float64, rng *rand.Rand) float64 {
+  var gammaDist = distuv.Gamma{Alpha: alpha, Beta: beta, Src: rng}
   return gammaDist.Rand()
 }
 
@@ -113,8 +136,8 @@ func GammaDistrubution(alpha, beta float64) float64 {
  * Function used for changing the tree structures, when initiated, a subtree is picked at random, a new
  * location in the left over tree is chosen and the sub tree is attached at this site.
  *---------------------------------------------------------------------------------------------------*/
-func MutateTopology(solution *node, rate float64, numSpecies int) *node {
-  chance := rand.Float64()
+func MutateTopology(solution *node, rate float64, numSpecies int, rng *rand.Rand) *node {
+  chance := rng.Float64()
   if chance < rate {
     totalNodes := 2*numSpecies - 1
     reqProb := float64(float64(1)/float64(totalNodes))
@@ -122,14 +145,14 @@ func MutateTopology(solution *node, rate float64, numSpecies int) *node {
     randSubtree = nil
 
     for randSubtree == nil {
-      randSubtree = PickRandomSubtree(solution, reqProb)
+      randSubtree = PickRandomSubtree(solution, reqProb, rng)
       if randSubtree == nil || randSubtree.parent == nil {
         randSubtree = nil
       }
     }
     var alteredBranchLength float64
     solution, alteredBranchLength = RemoveAndRestructureTree(solution, randSubtree)
-    solution = MergeSubTrees(solution, randSubtree, numSpecies, alteredBranchLength)
+    solution = MergeSubTrees(solution, randSubtree, numSpecies, alteredBranchLength, rng)
   }
   return solution
 }
@@ -138,11 +161,11 @@ func MutateTopology(solution *node, rate float64, numSpecies int) *node {
  * Quite similar to the topology mutation, except that the random subtree is selected from a different
  * tree and the current tree is reorganized to accomadate the new subTree
  *---------------------------------------------------------------------------------------------------*/
-func PerformCrossOver(solution *node, population []*node, recombinationProbability float64, numSpecies int) *node {
-  chance := rand.Float64()
+func PerformCrossOver(solution *node, population []*node, recombinationProbability float64, numSpecies int, rng *rand.Rand) *node {
+  chance := rng.Float64()
   if chance < recombinationProbability {
     numSolutions := len(population)
-    secondParentIndex := rand.Intn(numSolutions)
+    secondParentIndex := rng.IntN(numSolutions)
     secondParent := population[secondParentIndex]
 
     totalNodes := 2*numSpecies - 1
@@ -150,7 +173,7 @@ func PerformCrossOver(solution *node, population []*node, recombinationProbabili
     var randSubtree *node
     randSubtree = nil
     for randSubtree == nil {
-      randSubtree = PickRandomSubtree(secondParent, reqProb)
+      randSubtree = PickRandomSubtree(secondParent, reqProb, rng)
       if randSubtree == nil || randSubtree.parent == nil {
         randSubtree = nil
       }
@@ -161,7 +184,7 @@ func PerformCrossOver(solution *node, population []*node, recombinationProbabili
     randSubtree, alteredBranchLength = GenerateFreshSubTreeCopy(randSubtree)
     speciesSubList := CaptureSpecies(randSubtree, make([]string, 0))
     solution = RemoveSpecies(solution, solution, speciesSubList)
-    solution = MergeSubTrees(solution, randSubtree, numSpecies, alteredBranchLength)
+    solution = MergeSubTrees(solution, randSubtree, numSpecies, alteredBranchLength, rng)
   }
   return solution
 }
@@ -171,31 +194,31 @@ func PerformCrossOver(solution *node, population []*node, recombinationProbabili
  * It has been generally ensured the probability reflects upon the total number of nodese  in the graph
  * Might return nil nodes at times, should be run multiple times until a proper node is returned
  *---------------------------------------------------------------------------------------------------*/
-func PickRandomSubtree(root *node, prob float64) *node {
+func PickRandomSubtree(root *node, prob float64, rng *rand.Rand) *node {
   if root == nil {
     return nil
   }
   var subTree *node
-  chance := rand.Float64()
+  chance := rng.Float64()
   if chance < prob {
     return root
   }
 
   searchDirection := 0.5
-  chance = rand.Float64()
+  chance = rng.Float64()
   if chance < searchDirection {
-    subTree = PickRandomSubtree(root.leftChild, prob)
+    subTree = PickRandomSubtree(root.leftChild, prob, rng)
   } else {
-    subTree = PickRandomSubtree(root.rightChild, prob)
+    subTree = PickRandomSubtree(root.rightChild, prob, rng)
   }
   if subTree != nil {
     return subTree
   }
 
   if chance < searchDirection {
-    subTree = PickRandomSubtree(root.rightChild, prob)
+    subTree = PickRandomSubtree(root.rightChild, prob, rng)
   } else {
-    subTree = PickRandomSubtree(root.leftChild, prob)
+    subTree = PickRandomSubtree(root.leftChild, prob, rng)
   }
   return subTree
 }
@@ -232,6 +255,7 @@ func RemoveAndRestructureTree(root, randSubtree  *node) (*node, float64) {
       root = immParent.leftChild
     }
     root.parent = nil
+    root.model = immParent.model
     immParent = nil
   // The general case for rearrangement
   } else {
@@ -267,14 +291,14 @@ func RemoveAndRestructureTree(root, randSubtree  *node) (*node, float64) {
  * Given an imcomplete tree and a subTree, picks a random location on the incomplete tree and merges
  * the subtree at the given location
  *---------------------------------------------------------------------------------------------------*/
-func MergeSubTrees(root, randSubtree *node, numSpecies int, alteredBranchLength float64) *node{
+func MergeSubTrees(root, randSubtree *node, numSpecies int, alteredBranchLength float64, rng *rand.Rand) *node{
   var newRandLocation *node
   newRandLocation = nil
   reqProb := float64(1.0/float64(2*numSpecies - 1))
   for newRandLocation == nil {
-    newRandLocation = PickRandomSubtree(root, reqProb)
+    newRandLocation = PickRandomSubtree(root, reqProb, rng)
   }
-  root = ReorganizeTreeBranches(root, randSubtree, newRandLocation, alteredBranchLength)
+  root = ReorganizeTreeBranches(root, randSubtree, newRandLocation, alteredBranchLength, rng)
   return root
 }
 
@@ -282,18 +306,19 @@ func MergeSubTrees(root, randSubtree *node, numSpecies int, alteredBranchLength
  * Given a subgraph and a  partial tree, attaches the subtree at  a random location in the partial tree
  * to complete it
  *---------------------------------------------------------------------------------------------------*/
-func ReorganizeTreeBranches(root, randSubtree, newRandLocation *node, parentDist float64) *node  {
+func ReorganizeTreeBranches(root, randSubtree, newRandLocation *node, parentDist float64, rng *rand.Rand) *node  {
   if newRandLocation.leftChild == nil || newRandLocation.rightChild == nil {
     if newRandLocation.parent != nil {
       newRandLocation = newRandLocation.parent
     } else {
+      // The subtree is attached above the current root, which hands its substitution model over to the new root
       var insertionNode node
-      insertionNode.Initialize()
       insertionNode.name = "Ancestor"
+      insertionNode.model, newRandLocation.model = newRandLocation.model, nil
       insertionNode.leftChild = randSubtree
       insertionNode.rightChild = newRandLocation
       randSubtree.parent, newRandLocation.parent = &insertionNode, &insertionNode
-      insertionNode.leftChildDistance, insertionNode.rightChildDistance = parentDist, (rand.Float64()/10.0)
+      insertionNode.leftChildDistance, insertionNode.rightChildDistance = parentDist, (rng.Float64()/10.0)
       return &insertionNode
     }
   }
@@ -303,13 +328,7 @@ func ReorganizeTreeBranches(root, randSubtree, newRandLocation *node, parentDist
   insertionNode.leftChild = randSubtree
   randSubtree.parent = &insertionNode
   insertionNode.parent = newRandLocation
-  for i:=0; i<5; i++ {
-    insertionNode.nucleotideFrequencies[i] = newRandLocation.nucleotideFrequencies[i]
-    for j:=0; j<5; j++ {
-      insertionNode.conversionRatios[i][j] = newRandLocation.conversionRatios[i][j]
-    }
-  }
-  direction := rand.Float64()
+  direction := rng.Float64()
   if direction < 0.5 {
     insertionNode.rightChild = newRandLocation.leftChild
     newRandLocation.leftChild.parent = &insertionNode
@@ -330,7 +349,6 @@ func ReorganizeTreeBranches(root, randSubtree, newRandLocation *node, parentDist
 func GenerateFreshSubTreeCopy(subTree *node) (*node, float64) {
 
   var currNode node
-  currNode.Initialize()
   if subTree == nil {
     return nil, 0
   } else {
@@ -345,12 +363,6 @@ func GenerateFreshSubTreeCopy(subTree *node) (*node, float64) {
     if currNode.rightChild != nil {
       currNode.rightChild.parent = &currNode
     }
-    for i:=0; i<5; i++ {
-      currNode.nucleotideFrequencies[i] = subTree.nucleotideFrequencies[i]
-      for j:=0; j<5; j++ {
-        currNode.conversionRatios[i][j] = subTree.conversionRatios[i][j]
-      }
-    }
   }
 
   var parentDist float64